@@ -4,22 +4,56 @@ package main
 #cgo LDFLAGS: -L../target/release -lsafer_ffi_example
 #include <stdlib.h>
 #include "safer_ffi_example.h"
+
+// Goでエクスポートしたコールバック関数（定義はGo側）
+bool goNoteValidator(size_t handle, char *note);
+void goImportProgress(size_t handle, size_t done, size_t total);
+bool goTodoUpdater(size_t handle, Todo_t *todo, TodoEdit_t *edit);
+bool goTodoBatchSink(size_t handle, slice_ref_Todo_t batch);
 */
 import "C"
 import (
+	"errors"
 	"fmt"
+	"html"
+	"iter"
+	"runtime/cgo"
+	"strings"
+	"time"
 	"unsafe"
 )
 
+// ErrTodoNotFoundは指定したIDのTodoが存在しないことを表します
+var ErrTodoNotFound = errors.New("指定したIDのTodoが見つかりません")
+
+// ErrValidationFailedはSetNoteValidatorで登録した関数がノートを拒否したことを表します
+var ErrValidationFailed = errors.New("ノートが検証関数によって拒否されました")
+
+// ErrUnsupportedSchemaは読み込むデータのスキーマバージョンに対応していないことを表します
+var ErrUnsupportedSchema = errors.New("対応していないスキーマバージョンです")
+
 // Todoは単一のタスク項目を表します
 type Todo struct {
-	ID   int32
-	Note string
+	ID   int32  `json:"id"`
+	Note string `json:"note"`
+}
+
+// AllocStatsはノートの文字列サイズに関する統計を表します
+// サイズはいずれもバイト数で、ノートがない場合はすべて0になります
+type AllocStats struct {
+	Count        int
+	TotalBytes   int
+	MinBytes     int
+	MaxBytes     int
+	AverageBytes float64
 }
 
 // Appはラッパー構造体
 type App struct {
 	ptr *C.App_t
+
+	// validatorはSetNoteValidatorで登録した関数のハンドル（未登録の場合は0）
+	validator cgo.Handle
 }
 
 // NewAppはApp_tのインスタンスを作成します
@@ -37,6 +71,22 @@ func (a *App) AddTodo(id int32, note string) bool {
 	return bool(C.add_todo(a.ptr, C.int32_t(id), cNote))
 }
 
+// TryAddTodoはAddTodoと同様にTodoを追加し、追加できなかった場合はその理由をエラーで返します
+// 検証関数がノートを拒否した場合はErrValidationFailedを返します
+func (a *App) TryAddTodo(id int32, note string) error {
+	cNote := C.CString(note)
+	defer C.free(unsafe.Pointer(cNote))
+
+	switch C.try_add_todo(a.ptr, C.int32_t(id), cNote) {
+	case C.ADD_STATUS_ADDED:
+		return nil
+	case C.ADD_STATUS_VALIDATION_FAILED:
+		return ErrValidationFailed
+	default:
+		return errors.New("Todoの追加に失敗しました")
+	}
+}
+
 // GetTodoCountはTodoの数を返します
 func (a *App) GetTodoCount() int {
 	return int(C.get_todo_count(a.ptr))
@@ -62,10 +112,831 @@ func (a *App) GetTodoAt(index int) *Todo {
 	}
 }
 
+// AllReverseはTodoを末尾から先頭に向かって順に返すイテレータを返します
+// インデックスは元のリスト上の位置です。途中でbreakした場合、残りのTodoは取得しません
+func (a *App) AllReverse() iter.Seq2[int, Todo] {
+	return func(yield func(int, Todo) bool) {
+		for i := a.GetTodoCount() - 1; i >= 0; i-- {
+			todo := a.GetTodoAt(i)
+			if todo == nil {
+				continue
+			}
+			if !yield(i, *todo) {
+				return
+			}
+		}
+	}
+}
+
+// GetAllTodosはすべてのTodoのコピーを1回の呼び出しで取得します
+func (a *App) GetAllTodos() []Todo {
+	return todosFromVec(C.get_all_todos(a.ptr))
+}
+
+// AllPointersはすべてのTodoをポインタのスライスとして返します
+// 各Todoは呼び出し時点のコピーのため、返された値を書き換えてもApp内のTodoは変わりません
+func (a *App) AllPointers() []*Todo {
+	todos := a.GetAllTodos()
+	pointers := make([]*Todo, len(todos))
+	for i := range todos {
+		pointers[i] = &todos[i]
+	}
+	return pointers
+}
+
+// TodosWithIDBetweenはIDがlow以上high以下のTodoを元の順序のまま返します
+// lowがhighより大きい場合は空のスライスを返します
+func (a *App) TodosWithIDBetween(low, high int32) []Todo {
+	return todosFromVec(C.get_todos_with_id_between(a.ptr, C.int32_t(low), C.int32_t(high)))
+}
+
+// CountByはkeyが返す値ごとにTodoの件数を数えます
+// Todoがない場合は空のマップを返します
+func (a *App) CountBy(key func(Todo) string) map[string]int {
+	counts := make(map[string]int)
+	for _, todo := range a.GetAllTodos() {
+		counts[key(todo)]++
+	}
+	return counts
+}
+
+// CountByNoteSubstringはノートにsubstrを含むTodoの件数を返します
+// 一致したTodo自体はコピーしないため、件数だけが必要な場合に使います
+func (a *App) CountByNoteSubstring(substr string) int {
+	cSubstr := C.CString(substr)
+	defer C.free(unsafe.Pointer(cSubstr))
+
+	return int(C.count_todos_with_note_substring(a.ptr, cSubstr))
+}
+
+// FindByExactNoteはノートがnoteと完全に一致するTodoを返します
+// 部分一致で探す場合はFilterByAnyNoteを使います
+func (a *App) FindByExactNote(note string) []Todo {
+	cNote := C.CString(note)
+	defer C.free(unsafe.Pointer(cNote))
+
+	return todosFromVec(C.find_todos_by_exact_note(a.ptr, cNote))
+}
+
+// FilterByAnyNoteはノートにsubstrsのいずれかを含むTodoを返します
+// 1つのTodoが複数の文字列を含む場合も結果には1回だけ含まれます。substrsが空の場合は空のスライスを返します
+func (a *App) FilterByAnyNote(substrs []string) []Todo {
+	var todos []Todo
+	withCStrings(substrs, func(cSubstrs C.slice_ref_char_const_ptr_t) {
+		todos = todosFromVec(C.filter_todos_by_any_note(a.ptr, cSubstrs))
+	})
+	return todos
+}
+
+// FilterByAllNotesはノートにsubstrsをすべて含むTodoを返します
+// substrsが空の場合はすべてのTodoを返します
+func (a *App) FilterByAllNotes(substrs []string) []Todo {
+	var todos []Todo
+	withCStrings(substrs, func(cSubstrs C.slice_ref_char_const_ptr_t) {
+		todos = todosFromVec(C.filter_todos_by_all_notes(a.ptr, cSubstrs))
+	})
+	return todos
+}
+
+// withCStringsはstrsをC文字列の配列に変換してfnに渡します
+// 変換のために確保したC文字列はfnの終了後に解放されます
+func withCStrings(strs []string, fn func(C.slice_ref_char_const_ptr_t)) {
+	// スライスのポインタはNULLにできないため、空の場合も1要素分確保する
+	cStrs := make([]*C.char, max(len(strs), 1))
+	for i, str := range strs {
+		cStrs[i] = C.CString(str)
+		defer C.free(unsafe.Pointer(cStrs[i]))
+	}
+
+	fn(C.slice_ref_char_const_ptr_t{ptr: &cStrs[0], len: C.size_t(len(strs))})
+}
+
+// ToHTMLはTodoの一覧をHTMLの<table>として返します
+// ノートはHTMLエスケープされるため、そのままページに埋め込めます
+func (a *App) ToHTML() string {
+	var b strings.Builder
+	b.WriteString("<table>\n")
+	b.WriteString("<tr><th>ID</th><th>Note</th></tr>\n")
+	for _, todo := range a.GetAllTodos() {
+		fmt.Fprintf(&b, "<tr><td>%d</td><td>%s</td></tr>\n", todo.ID, html.EscapeString(todo.Note))
+	}
+	b.WriteString("</table>\n")
+
+	return b.String()
+}
+
+// TakeMatchingはpredを満たすTodoを先頭から最大n件返します
+// n件見つかった時点で走査を打ち切るため、リスト全体を走査しません
+func (a *App) TakeMatching(n int, pred func(Todo) bool) []Todo {
+	matched := make([]Todo, 0, max(n, 0))
+	if n <= 0 {
+		return matched
+	}
+
+	count := a.GetTodoCount()
+	for i := 0; i < count && len(matched) < n; i++ {
+		todo := a.GetTodoAt(i)
+		if todo != nil && pred(*todo) {
+			matched = append(matched, *todo)
+		}
+	}
+
+	return matched
+}
+
+// CloneMatchingはpredを満たすTodoのコピーだけを持つ新しいAppを返します
+// 元のAppは変更されません。返されたAppは元のAppとは別にFreeする必要があります
+func (a *App) CloneMatching(pred func(Todo) bool) *App {
+	matched := make([]Todo, 0)
+	for _, todo := range a.GetAllTodos() {
+		if pred(todo) {
+			matched = append(matched, todo)
+		}
+	}
+
+	// 一致したTodoを新しいAppに1回の呼び出しでまとめて追加する
+	clone := NewApp()
+	clone.AddTodos(matched)
+	return clone
+}
+
+// BumpRevisionはリビジョンを1つ進め、進めた後の値を返します
+func (a *App) BumpRevision() uint64 {
+	return uint64(C.bump_revision(a.ptr))
+}
+
+// Revisionは現在のリビジョンを返します
+func (a *App) Revision() uint64 {
+	return uint64(C.get_revision(a.ptr))
+}
+
+// PageJSONはoffsetから最大limit件のTodoをJSON文字列で返します
+// 結果には全件数を表すtotalフィールドが含まれます
+func (a *App) PageJSON(offset, limit int) (string, error) {
+	if offset < 0 || limit < 0 {
+		return "", fmt.Errorf("offsetとlimitは0以上である必要があります: offset=%d, limit=%d", offset, limit)
+	}
+
+	cJSON := C.todos_page_json(a.ptr, C.size_t(offset), C.size_t(limit))
+	if cJSON == nil {
+		return "", errors.New("TodoのJSON変換に失敗しました")
+	}
+	defer C.free_char_p_box(cJSON)
+
+	return C.GoString(cJSON), nil
+}
+
+// TodoToJSONは指定IDのTodoだけをJSON文字列で返します
+// 指定IDのTodoが存在しない場合はErrTodoNotFoundを返します
+func (a *App) TodoToJSON(id int32) (string, error) {
+	cJSON := C.todo_json_by_id(a.ptr, C.int32_t(id))
+	if cJSON == nil {
+		return "", fmt.Errorf("%w: ID=%d", ErrTodoNotFound, id)
+	}
+	defer C.free_char_p_box(cJSON)
+
+	return C.GoString(cJSON), nil
+}
+
+// SchemaVersionはToJSONが書き出し、LoadFromJSONが読み込める形式のスキーマバージョンを返します
+func SchemaVersion() int {
+	return int(C.current_schema_version())
+}
+
+// ToJSONはすべてのTodoを{"schema_version":..,"todos":[..]}形式のJSONで返します
+func (a *App) ToJSON() (string, error) {
+	cJSON := C.todos_to_json(a.ptr)
+	if cJSON == nil {
+		return "", errors.New("TodoのJSON変換に失敗しました")
+	}
+	defer C.free_char_p_box(cJSON)
+
+	return C.GoString(cJSON), nil
+}
+
+// LoadFromJSONはToJSONの形式のJSONを読み込み、Todoリストを置き換えます
+// スキーマバージョンがSchemaVersionと異なる場合はErrUnsupportedSchemaを返します
+// 失敗した場合、Todoリストは変更されません
+func (a *App) LoadFromJSON(data string) error {
+	cData := C.CString(data)
+	defer C.free(unsafe.Pointer(cData))
+
+	return loadStatusError(C.load_todos_from_json(a.ptr, cData), "JSON")
+}
+
+// loadStatusErrorはRust側の読み込み結果をエラーに変換します
+// formatには失敗時のメッセージに含めるデータ形式の名前を渡します
+func loadStatusError(status C.LoadStatus_t, format string) error {
+	switch status {
+	case C.LOAD_STATUS_OK:
+		return nil
+	case C.LOAD_STATUS_UNSUPPORTED_SCHEMA:
+		return ErrUnsupportedSchema
+	default:
+		return fmt.Errorf("%sの読み込みに失敗しました", format)
+	}
+}
+
+// MigrateJSONは古い形式のJSONをToJSONと同じ現在の形式に変換します
+// スキーマバージョン導入前の形式（Todoの配列）に対応し、現在の形式はそのまま返します
+// 現在より新しいスキーマバージョンや不正な形式の場合はエラーを返します
+func MigrateJSON(data string) (string, error) {
+	cData := C.CString(data)
+	defer C.free(unsafe.Pointer(cData))
+
+	cJSON := C.migrate_todos_json(cData)
+	if cJSON == nil {
+		return "", errors.New("JSONを現在の形式に変換できません")
+	}
+	defer C.free_char_p_box(cJSON)
+
+	return C.GoString(cJSON), nil
+}
+
+// ToJSONLはすべてのTodoを1行に1件ずつのJSON（JSON Lines形式）で返します
+func (a *App) ToJSONL() (string, error) {
+	cJSONL := C.todos_to_jsonl(a.ptr)
+	if cJSONL == nil {
+		return "", errors.New("TodoのJSONL変換に失敗しました")
+	}
+	defer C.free_char_p_box(cJSONL)
+
+	return C.GoString(cJSONL), nil
+}
+
+// LoadFromJSONLはJSON Lines形式の文字列を読み込み、Todoリストを置き換えます
+// 空行と末尾の改行は無視されます。解析に失敗した場合、Todoリストは変更されません
+func (a *App) LoadFromJSONL(data string) error {
+	cData := C.CString(data)
+	defer C.free(unsafe.Pointer(cData))
+
+	if !C.load_todos_from_jsonl(a.ptr, cData) {
+		return errors.New("JSONLの読み込みに失敗しました")
+	}
+	return nil
+}
+
+// DiffPatchはotherとの差分をJSONのパッチとして返します
+// パッチは{"removed":[ID..],"changed":[Todo..],"added":[Todo..]}の形式で、ApplyPatchで適用できます
+// IDをキーに比較するため、同じIDのTodoが複数ある場合はそれぞれ先頭のものだけが比較されます
+func (a *App) DiffPatch(other *App) (string, error) {
+	cPatch := C.todos_diff_patch_json(a.ptr, other.ptr)
+	if cPatch == nil {
+		return "", errors.New("差分のJSON変換に失敗しました")
+	}
+	defer C.free_char_p_box(cPatch)
+
+	return C.GoString(cPatch), nil
+}
+
+// ApplyPatchはDiffPatchが返したパッチをTodoリストに適用します
+// 削除したTodoの位置は詰められ、追加されたTodoは末尾に追加されます
+// パッチが不正な場合や現在の状態に適用できない場合、Todoリストは変更されません
+func (a *App) ApplyPatch(patch string) error {
+	cPatch := C.CString(patch)
+	defer C.free(unsafe.Pointer(cPatch))
+
+	if !C.apply_todos_patch_json(a.ptr, cPatch) {
+		return errors.New("パッチを適用できません")
+	}
+	return nil
+}
+
+// ValidatePatchはパッチがApplyPatchで現在のTodoリストに適用できるかを確認します
+// Todoリストは変更されません。適用できない場合はエラーを返します
+func (a *App) ValidatePatch(patch string) error {
+	cPatch := C.CString(patch)
+	defer C.free(unsafe.Pointer(cPatch))
+
+	if !C.validate_todos_patch_json(a.ptr, cPatch) {
+		return errors.New("パッチを適用できません")
+	}
+	return nil
+}
+
+// ToMsgPackはすべてのTodoをToJSONと同じ構造（schema_versionとtodosを持つマップ）のMessagePack形式で返します
+func (a *App) ToMsgPack() ([]byte, error) {
+	vec := C.todos_to_msgpack(a.ptr)
+	defer C.free_byte_vec(vec)
+
+	// 空のリストも1バイトになるため、空の場合は失敗を表す
+	if vec.len == 0 {
+		return nil, errors.New("TodoのMessagePack変換に失敗しました")
+	}
+	return C.GoBytes(unsafe.Pointer(vec.ptr), C.int(vec.len)), nil
+}
+
+// LoadFromMsgPackはToMsgPackの形式のバイト列を読み込み、Todoリストを置き換えます
+// スキーマバージョンがSchemaVersionと異なる場合はErrUnsupportedSchemaを返します
+// 失敗した場合、Todoリストは変更されません
+func (a *App) LoadFromMsgPack(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("MessagePackの読み込みに失敗しました")
+	}
+
+	// GoのメモリのままRust側に渡すため、呼び出し中はdataを保持する
+	status := C.load_todos_from_msgpack(a.ptr, C.slice_ref_uint8_t{
+		ptr: (*C.uint8_t)(unsafe.Pointer(&data[0])),
+		len: C.size_t(len(data)),
+	})
+	return loadStatusError(status, "MessagePack")
+}
+
+// ImportJSONWithProgressはToJSONの形式のJSONを読み込み、Todoリストを置き換えます
+// LoadFromJSONと同様に、スキーマバージョンがSchemaVersionと異なる場合はErrUnsupportedSchemaを返します
+// 読み込み中は解析と同時に全体の約1%ごとにonProgressが呼び出され、成功した場合は最後に必ずdone == totalで呼び出されます
+// 途中で解析に失敗した場合は、それまでの進捗を通知した後でエラーを返します
+// onProgressはnilでも構いません。失敗した場合、Todoリストは変更されません
+func (a *App) ImportJSONWithProgress(data string, onProgress func(done, total int)) error {
+	cData := C.CString(data)
+	defer C.free(unsafe.Pointer(cData))
+
+	var status C.LoadStatus_t
+	if onProgress == nil {
+		status = C.import_todos_json_with_progress(a.ptr, cData, nil, 0)
+	} else {
+		// Goの関数はC側に直接渡せないため、呼び出しの間だけハンドル経由で参照させる
+		handle := cgo.NewHandle(onProgress)
+		defer handle.Delete()
+		status = C.import_todos_json_with_progress(a.ptr, cData, (*[0]byte)(C.goImportProgress), C.size_t(handle))
+	}
+
+	return loadStatusError(status, "JSON")
+}
+
+//export goImportProgress
+func goImportProgress(handle C.size_t, done, total C.size_t) {
+	fn := cgo.Handle(handle).Value().(func(done, total int))
+	fn(int(done), int(total))
+}
+
+// ChecksumFileはpathのファイルの内容からチェックサムを計算します
+// 保存したファイルを読み込む前に、破損していないかを確認するために使います
+func ChecksumFile(path string) (uint64, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	var checksum C.uint64_t
+	if !C.checksum_file(cPath, &checksum) {
+		return 0, fmt.Errorf("ファイルを読み込めません: %s", path)
+	}
+	return uint64(checksum), nil
+}
+
+// ContentHashはTodoリストの内容から計算したハッシュ値を返します
+// 内容または並び順が変わるとハッシュ値も変わります
+func (a *App) ContentHash() uint64 {
+	return uint64(C.content_hash(a.ptr))
+}
+
+// SnapshotWithHashはTodoリストのコピーと、そのContentHashを同時に返します
+// 両方を1回の呼び出しで同じ状態から求めるため、ハッシュ値は必ず返したリストと対応します
+func (a *App) SnapshotWithHash() ([]Todo, uint64) {
+	snapshot := C.snapshot_with_hash(a.ptr)
+	return todosFromVec(snapshot.todos), uint64(snapshot.hash)
+}
+
+// TodoHashByIDは指定IDのTodoの内容から計算したハッシュ値を返します
+// 他のTodoの変更には影響されないため、同期時にどのTodoが変更されたかを検出できます
+// 指定IDのTodoが存在しない場合はfalseを返します
+func (a *App) TodoHashByID(id int32) (uint64, bool) {
+	index := C.find_todo_index(a.ptr, C.int32_t(id))
+	if index < 0 {
+		return 0, false
+	}
+
+	return uint64(C.todo_hash_at(a.ptr, C.size_t(index))), true
+}
+
+// ReplaceAllIfHashは現在のContentHashがexpectedと一致する場合のみTodoリストをtodosで置き換えます
+// 置き換えた場合はtrueを返します
+func (a *App) ReplaceAllIfHash(expected uint64, todos []Todo) bool {
+	var swapped bool
+	withTodoRefs(todos, func(refs C.slice_ref_TodoRef_t) {
+		swapped = bool(C.replace_all_if_hash(a.ptr, C.uint64_t(expected), refs))
+	})
+	return swapped
+}
+
+// AddTemplatedはtemplate中の{{key}}をvarsの値で置き換えたノートでTodoを追加します
+// varsに対応するキーがないプレースホルダーは{{key}}のまま残ります
+func (a *App) AddTemplated(id int32, template string, vars map[string]string) bool {
+	cTemplate := C.CString(template)
+	defer C.free(unsafe.Pointer(cTemplate))
+
+	// スライスのポインタはNULLにできないため、空の場合も1要素分確保する
+	cVars := make([]C.TemplateVar_t, max(len(vars), 1))
+	i := 0
+	for key, value := range vars {
+		cKey := C.CString(key)
+		defer C.free(unsafe.Pointer(cKey))
+		cValue := C.CString(value)
+		defer C.free(unsafe.Pointer(cValue))
+		cVars[i] = C.TemplateVar_t{key: cKey, value: cValue}
+		i++
+	}
+
+	slice := C.slice_ref_TemplateVar_t{ptr: &cVars[0], len: C.size_t(len(vars))}
+	return bool(C.add_templated_todo(a.ptr, C.int32_t(id), cTemplate, slice))
+}
+
+// NoteAllocStatsはノートの文字列サイズに関する統計を返します
+func (a *App) NoteAllocStats() AllocStats {
+	stats := C.note_alloc_stats(a.ptr)
+	return AllocStats{
+		Count:        int(stats.count),
+		TotalBytes:   int(stats.total_bytes),
+		MinBytes:     int(stats.min_bytes),
+		MaxBytes:     int(stats.max_bytes),
+		AverageBytes: float64(stats.average_bytes),
+	}
+}
+
+// StreamBatchesはTodoをbatchSize件ずつコピーしてsinkに渡します
+// 1回の呼び出しで保持するTodoはbatchSize件までに抑えられます
+// Rust側で読み取りロックを保持したまま走査するため、途中で他のgoroutineが変更しても同じ時点のTodoが抜けや重複なく渡されます
+// sinkはAppのロックを保持したまま呼び出されるため、中から同じAppのメソッドを呼び出してはいけません
+// sinkがエラーを返した場合はそこで中断し、そのエラーを返します
+func (a *App) StreamBatches(batchSize int, sink func([]Todo) error) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("batchSizeは1以上である必要があります: %d", batchSize)
+	}
+
+	var sinkErr error
+	handle := cgo.NewHandle(func(batch []Todo) bool {
+		sinkErr = sink(batch)
+		return sinkErr == nil
+	})
+	defer handle.Delete()
+
+	C.stream_todo_batches(a.ptr, C.size_t(batchSize), (*[0]byte)(C.goTodoBatchSink), C.size_t(handle))
+	return sinkErr
+}
+
+//export goTodoBatchSink
+func goTodoBatchSink(handle C.size_t, batch C.slice_ref_Todo_t) C.bool {
+	fn := cgo.Handle(handle).Value().(func([]Todo) bool)
+
+	todos := make([]Todo, 0, int(batch.len))
+	for _, todo := range unsafe.Slice(batch.ptr, int(batch.len)) {
+		todos = append(todos, Todo{
+			ID:   int32(todo.id),
+			Note: C.GoString(todo.note),
+		})
+	}
+	return C.bool(fn(todos))
+}
+
+// todosFromVecはRust側で確保したTodoのVecをGoのスライスにコピーし、Vecを解放します
+func todosFromVec(vec C.Vec_Todo_t) []Todo {
+	defer C.free_todo_vec(vec)
+
+	todos := make([]Todo, 0, int(vec.len))
+	if vec.len == 0 {
+		return todos
+	}
+
+	for _, todo := range unsafe.Slice(vec.ptr, int(vec.len)) {
+		todos = append(todos, Todo{
+			ID:   int32(todo.id),
+			Note: C.GoString(todo.note),
+		})
+	}
+
+	return todos
+}
+
+// FirstUnsortedByIDはtodo[i].ID > todo[i+1].IDとなる最初のインデックスiを返します
+// IDの昇順に並んでいる場合は-1を返します
+func (a *App) FirstUnsortedByID() int {
+	return int(C.first_unsorted_by_id(a.ptr))
+}
+
+// HasOversizedNoteはノートのバイト数がmaxBytesを超えるTodoがあるかと、その最初のインデックスを返します
+// 該当するTodoがない場合はfalseと-1を返します。バイト数はUTF-8でのバイト数です
+func (a *App) HasOversizedNote(maxBytes int) (bool, int) {
+	index := int(C.first_oversized_note_index(a.ptr, C.size_t(max(maxBytes, 0))))
+	return index >= 0, index
+}
+
+// IsSortedByIDはTodoがIDの昇順に並んでいるかを返します
+func (a *App) IsSortedByID() bool {
+	return a.FirstUnsortedByID() == -1
+}
+
+// SetSortedInsertはAddTodoでIDの昇順を保つ位置へ挿入するかどうかを設定します
+// 既存のTodoは並べ替えないため、昇順に並んでいる間だけ順序が保たれます
+func (a *App) SetSortedInsert(enabled bool) {
+	C.set_sorted_insert(a.ptr, C.bool(enabled))
+}
+
+// SortedInsertPosはIDの昇順を保つためにidを挿入すべきインデックスを返します
+// SetSortedInsertを有効にしたAddTodoが挿入する位置と同じで、同じIDがある場合はその後ろになります
+// Todoが既にIDの昇順に並んでいることが前提です（IsSortedByIDで確認できます）
+func (a *App) SortedInsertPos(id int32) int {
+	return int(C.sorted_insert_pos(a.ptr, C.int32_t(id)))
+}
+
+// UpsertTodosはIDをキーにTodoをまとめて追加または更新し、追加した件数と更新した件数を返します
+// 既存のIDはノートが更新され、新しいIDはAddTodoと同じ位置（SetSortedInsertが有効ならソート位置、そうでなければ末尾）に追加されます
+// SetNoteValidatorの検証関数が拒否したTodoは更新・追加されず、件数にも数えられません
+func (a *App) UpsertTodos(todos []Todo) (inserted, updated int) {
+	withTodoRefs(todos, func(refs C.slice_ref_TodoRef_t) {
+		counts := C.upsert_todos(a.ptr, refs)
+		inserted, updated = int(counts.inserted), int(counts.updated)
+	})
+	return inserted, updated
+}
+
+// MergeWithはsrcのTodoをdstに取り込みます
+// dstにないIDのTodoはUpsertTodosと同じ位置に追加されます。IDが衝突した場合はresolveにdst側のTodoとsrc側のTodoを渡し、
+// 返されたTodoのノートでdst側を更新します（IDは衝突したIDのまま変わりません）
+// srcは変更されません
+func (dst *App) MergeWith(src *App, resolve func(a, b Todo) Todo) {
+	if dst.ptr == src.ptr {
+		return
+	}
+
+	// 衝突の判定にはUpsertTodosと同じく、同じIDのうち先頭のTodoを使う
+	current := make(map[int32]Todo)
+	for _, todo := range dst.GetAllTodos() {
+		if _, ok := current[todo.ID]; !ok {
+			current[todo.ID] = todo
+		}
+	}
+
+	merged := make([]Todo, 0)
+	for _, todo := range src.GetAllTodos() {
+		if existing, ok := current[todo.ID]; ok {
+			todo = Todo{ID: todo.ID, Note: resolve(existing, todo).Note}
+		}
+		// src内で同じIDが続く場合は、解決済みの結果と比べる
+		current[todo.ID] = todo
+		merged = append(merged, todo)
+	}
+
+	dst.UpsertTodos(merged)
+}
+
+// DedupByIDKeepLastは同じIDのTodoを、それぞれ最後のものだけ残して削除し、削除した件数を返します
+// 後から追加されたTodoほど新しいデータとみなします。残ったTodoは元の並び順を保ちます
+func (a *App) DedupByIDKeepLast() int {
+	return int(C.dedup_todos_by_id_keep_last(a.ptr))
+}
+
+// withTodoRefsはtodosをC側のTodoRef_t配列に変換してfnに渡します
+// 変換のために確保したC文字列はfnの終了後に解放されます
+func withTodoRefs(todos []Todo, fn func(C.slice_ref_TodoRef_t)) {
+	// スライスのポインタはNULLにできないため、空の場合も1要素分確保する
+	refs := make([]C.TodoRef_t, max(len(todos), 1))
+	for i, todo := range todos {
+		cNote := C.CString(todo.Note)
+		defer C.free(unsafe.Pointer(cNote))
+		refs[i] = C.TodoRef_t{id: C.int32_t(todo.ID), note: cNote}
+	}
+
+	fn(C.slice_ref_TodoRef_t{ptr: &refs[0], len: C.size_t(len(todos))})
+}
+
+// AddTodosはtodosをこの順にまとめて追加し、追加した件数を返します
+// AddTodoと同じ規則で追加し、検証関数が拒否したTodoは追加しません
+func (a *App) AddTodos(todos []Todo) int {
+	var added int
+	withTodoRefs(todos, func(refs C.slice_ref_TodoRef_t) {
+		added = int(C.add_todos(a.ptr, refs))
+	})
+	return added
+}
+
+// TrimNoteは指定IDのTodoのノートから前後の空白を取り除きます
+// 指定IDのTodoが存在しない場合はfalseを返します
+func (a *App) TrimNote(id int32) bool {
+	return bool(C.trim_todo_note(a.ptr, C.int32_t(id)))
+}
+
+// NoteAtTruncatedは指定インデックスのTodoのノートを先頭からmaxRunes文字までに切り詰めて返します
+// 保存されているノートは変更されません。インデックスが範囲外の場合は空文字列を返します
+func (a *App) NoteAtTruncated(index int, maxRunes int) string {
+	if index < 0 || index >= a.GetTodoCount() {
+		return ""
+	}
+
+	cNote := C.get_todo_note_truncated_at(a.ptr, C.size_t(index), C.size_t(max(maxRunes, 0)))
+	defer C.free_char_p_box(cNote)
+
+	return C.GoString(cNote)
+}
+
+// NotePtrAtは指定インデックスのTodoのノートを指す内部ポインタと、そのバイト長を返します
+// ノートをコピーせずに他のCライブラリへ渡すための低レベルなAPIです
+// インデックスが範囲外の場合はnilと0を返します
+//
+// 注意: 返されるポインタはRust側が所有するメモリを直接指しています
+//   - ノートの変更、Todoの追加・削除・並べ替え、Appの解放のいずれかを行うと無効になります
+//   - 参照先を書き換えたり解放したりしてはいけません
+//   - Goの文字列として使う場合は、無効になる前にコピーしてください
+func (a *App) NotePtrAt(index int) (unsafe.Pointer, int) {
+	if index < 0 || index >= a.GetTodoCount() {
+		return nil, 0
+	}
+
+	note := C.get_todo_note_bytes_at(a.ptr, C.size_t(index))
+	return unsafe.Pointer(note.ptr), int(note.len)
+}
+
+// GetByIDsはidsの各IDのTodoを、idsと同じ順序・同じ件数で返します
+// 見つからなかったIDの位置はnilになります。同じIDのTodoが複数ある場合は先頭に近いものを返します
+func (a *App) GetByIDs(ids []int32) []*Todo {
+	todos := make([]*Todo, len(ids))
+	if len(ids) == 0 {
+		return todos
+	}
+
+	vec := C.get_todos_by_ids(a.ptr, C.slice_ref_int32_t{
+		ptr: (*C.int32_t)(unsafe.Pointer(&ids[0])),
+		len: C.size_t(len(ids)),
+	})
+	defer C.free_todo_lookups(vec)
+
+	for i, lookup := range unsafe.Slice(vec.ptr, int(vec.len)) {
+		if lookup.note != nil {
+			todos[i] = &Todo{
+				ID:   int32(lookup.id),
+				Note: C.GoString(lookup.note),
+			}
+		}
+	}
+
+	return todos
+}
+
+// CopyTodoByIDは指定IDのTodoを、Appから切り離された独立したコピーとして返します
+// 文字列はすべてGo側にコピーされるため、Appを解放した後も安全に利用できます
+func (a *App) CopyTodoByID(id int32) (*Todo, bool) {
+	index := int(C.find_todo_index(a.ptr, C.int32_t(id)))
+	if index < 0 {
+		return nil, false
+	}
+
+	todo := a.GetTodoAt(index)
+	return todo, todo != nil
+}
+
+// WithTodoは指定IDのTodoのコピーをfnに渡し、fnがtrueを返した場合はfnが変更したノートで書き戻します
+// 検索から書き戻しまでRust側のロックを保持したまま行うため、同じAppに対する他の操作が割り込むことはありません
+// fnはロックを保持したまま呼び出されるため、fnの中で同じAppのメソッドを呼び出すとデッドロックします
+// IDは変更できず、fnがIDを変更した場合は書き戻しません。新しいノートはAddTodoと同様に検証関数の対象になります
+// 指定IDのTodoが存在しない場合はfnを呼び出しません。書き戻した場合のみtrueを返します
+func (a *App) WithTodo(id int32, fn func(*Todo) bool) bool {
+	// Goの関数はC側に直接渡せないため、ハンドル経由で参照させる
+	handle := cgo.NewHandle(fn)
+	defer handle.Delete()
+
+	return bool(C.with_todo(a.ptr, C.int32_t(id), (*[0]byte)(C.goTodoUpdater), C.size_t(handle)))
+}
+
+//export goTodoUpdater
+func goTodoUpdater(handle C.size_t, todo *C.Todo_t, edit *C.TodoEdit_t) C.bool {
+	fn := cgo.Handle(handle).Value().(func(*Todo) bool)
+	copied := &Todo{
+		ID:   int32(todo.id),
+		Note: C.GoString(todo.note),
+	}
+	if !fn(copied) || copied.ID != int32(todo.id) {
+		return false
+	}
+
+	cNote := C.CString(copied.Note)
+	defer C.free(unsafe.Pointer(cNote))
+
+	C.todo_edit_set_note(edit, cNote)
+	return true
+}
+
+// SwapContentsはotherとTodoリストを入れ替えます
+// ノートの再確保は行われず、入れ替え後も両方のAppをそれぞれ解放できます
+func (a *App) SwapContents(other *App) {
+	C.swap_app_contents(a.ptr, other.ptr)
+}
+
+// SetNoteValidatorはTodo追加時にノートを検証する関数を登録します
+// fnがfalseを返したノートはAddTodoで拒否され、AddTodoはfalseを返します
+// 検証の対象はAddTodo、TryAddTodo、AddTodos、AddTemplated、WithTodo、UpsertTodos（MergeWithを含む）で保存されるノートだけです
+// ReplaceAllIfHash、LoadFromJSON、LoadFromJSONL、LoadFromMsgPack、ImportJSONWithProgress、ApplyPatchは検証せずにそのまま保存します
+// fnにnilを渡すと登録を解除します
+// fnはAppのロックを保持したまま呼び出されるため、中から同じAppのメソッドを呼び出してはいけません
+func (a *App) SetNoteValidator(fn func(string) bool) {
+	previous := a.validator
+	a.validator = 0
+
+	if fn == nil {
+		C.set_note_validator(a.ptr, nil, 0)
+	} else {
+		// Goの関数はC側に直接渡せないため、ハンドル経由で参照させる
+		a.validator = cgo.NewHandle(fn)
+		C.set_note_validator(a.ptr, (*[0]byte)(C.goNoteValidator), C.size_t(a.validator))
+	}
+
+	// Rust側が参照しなくなった以前のハンドルを解放
+	if previous != 0 {
+		previous.Delete()
+	}
+}
+
+//export goNoteValidator
+func goNoteValidator(handle C.size_t, note *C.char) C.bool {
+	fn := cgo.Handle(handle).Value().(func(string) bool)
+	return C.bool(fn(C.GoString(note)))
+}
+
+// SetInstrumentationはRust側のFFI関数の呼び出し回数の計測を有効または無効にします
+// 計測はすべてのAppで共通です。無効にしてもそれまでの回数は保持されます
+func SetInstrumentation(enabled bool) {
+	C.set_instrumentation(C.bool(enabled))
+}
+
+// ResetCallCountsは記録したFFI関数の呼び出し回数をすべて0に戻します
+func ResetCallCounts() {
+	C.reset_call_counts()
+}
+
+// CallCountsは計測を有効にしてから呼び出されたFFI関数ごとの呼び出し回数を返します
+func CallCounts() map[string]uint64 {
+	vec := C.get_call_counts()
+	defer C.free_call_counts(vec)
+
+	counts := make(map[string]uint64, int(vec.len))
+	if vec.len == 0 {
+		return counts
+	}
+
+	for _, count := range unsafe.Slice(vec.ptr, int(vec.len)) {
+		counts[C.GoString(count.name)] = uint64(count.count)
+	}
+
+	return counts
+}
+
+// WithCrossingStatsはfnを実行し、その間に呼び出されたRust側のFFI関数の回数を返します
+// 実行中は呼び出し回数の計測を有効にし、終了後に元の状態へ戻します
+// 計測はすべてのAppで共通のため、同時に他のgoroutineから呼び出した分も含まれます
+func (a *App) WithCrossingStats(fn func()) uint64 {
+	enabled := bool(C.is_instrumentation_enabled())
+	SetInstrumentation(true)
+	defer SetInstrumentation(enabled)
+
+	before := totalCallCount()
+	fn()
+	return totalCallCount() - before
+}
+
+// totalCallCountは記録したFFI関数の呼び出し回数の合計を返します
+func totalCallCount() uint64 {
+	var total uint64
+	for _, count := range CallCounts() {
+		total += count
+	}
+	return total
+}
+
+// SetTimingはRust側のFFI関数ごとの実行時間の計測を有効または無効にします
+// 計測はすべてのAppで共通です。無効にしてもそれまでの累積時間は保持されます
+func SetTiming(enabled bool) {
+	C.set_timing(C.bool(enabled))
+}
+
+// ResetTimingStatsは記録したFFI関数の累積実行時間をすべて0に戻します
+func ResetTimingStats() {
+	C.reset_timing_stats()
+}
+
+// TimingStatsは計測を有効にしてからFFI関数ごとにRust側で費やした時間の合計を返します
+// cgoの呼び出し自体にかかる時間は含まれません
+func TimingStats() map[string]time.Duration {
+	vec := C.get_timing_stats()
+	defer C.free_timing_stats(vec)
+
+	stats := make(map[string]time.Duration, int(vec.len))
+	if vec.len == 0 {
+		return stats
+	}
+
+	for _, timing := range unsafe.Slice(vec.ptr, int(vec.len)) {
+		stats[C.GoString(timing.name)] = time.Duration(timing.nanos)
+	}
+
+	return stats
+}
+
 // Free はアプリケーションのメモリを解放します
 func (a *App) Free() {
 	C.app_free(a.ptr)
 	a.ptr = nil // ダングリングポインタを防止
+
+	if a.validator != 0 {
+		a.validator.Delete()
+		a.validator = 0
+	}
 }
 
 func main() {
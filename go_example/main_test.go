@@ -1,8 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // TestAddTodo はTodoの追加機能をテストします
@@ -33,6 +49,37 @@ func TestAddTodo(t *testing.T) {
 	}
 }
 
+// TestAddTodos はまとめて追加したTodoが順に追加され、拒否されたものだけが除かれることをテストします
+func TestAddTodos(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "既存のタスク")
+	app.SetNoteValidator(func(note string) bool { return note != "" })
+
+	added := app.AddTodos([]Todo{
+		{ID: 3, Note: "タスク3"},
+		{ID: 4, Note: ""},
+		{ID: 2, Note: "タスク2"},
+	})
+	if added != 2 {
+		t.Errorf("期待した追加件数: 2, 実際: %d", added)
+	}
+
+	expected := []Todo{
+		{ID: 1, Note: "既存のタスク"},
+		{ID: 3, Note: "タスク3"},
+		{ID: 2, Note: "タスク2"},
+	}
+	if got := app.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待した内容: %v, 実際: %v", expected, got)
+	}
+
+	if added := app.AddTodos(nil); added != 0 {
+		t.Errorf("空の入力で追加された: %d", added)
+	}
+}
+
 // TestGetTodo はTodoの取得機能をテストします
 func TestGetTodo(t *testing.T) {
 	app := NewApp()
@@ -76,6 +123,1939 @@ func TestGetTodo(t *testing.T) {
 	}
 }
 
+// TestAllReverse はTodoが末尾から元のインデックス付きで返されることをテストします
+func TestAllReverse(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+	app.AddTodo(3, "友達に電話する")
+
+	var indices []int
+	var ids []int32
+	for i, todo := range app.AllReverse() {
+		indices = append(indices, i)
+		ids = append(ids, todo.ID)
+	}
+
+	if want := []int{2, 1, 0}; !slices.Equal(indices, want) {
+		t.Errorf("期待したインデックス: %v, 実際: %v", want, indices)
+	}
+	if want := []int32{3, 2, 1}; !slices.Equal(ids, want) {
+		t.Errorf("期待したID: %v, 実際: %v", want, ids)
+	}
+}
+
+// TestAllReverseBreak は途中でbreakすると走査が止まることをテストします
+func TestAllReverseBreak(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 10 {
+		app.AddTodo(int32(i), "タスク")
+	}
+
+	var ids []int32
+	for _, todo := range app.AllReverse() {
+		ids = append(ids, todo.ID)
+		if len(ids) == 2 {
+			break
+		}
+	}
+
+	if want := []int32{9, 8}; !slices.Equal(ids, want) {
+		t.Errorf("期待したID: %v, 実際: %v", want, ids)
+	}
+
+	// 空のリストでは何も返されない
+	empty := NewApp()
+	defer empty.Free()
+	for i, todo := range empty.AllReverse() {
+		t.Errorf("空のリストで値が返された: %d, %+v", i, todo)
+	}
+}
+
+// TestGetAllTodos はすべてのTodoを一括で取得できることをテストします
+func TestGetAllTodos(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	if todos := app.GetAllTodos(); len(todos) != 0 {
+		t.Errorf("空のリストで期待した件数: 0, 実際: %d", len(todos))
+	}
+
+	expected := []Todo{{1, "タスク1"}, {2, "タスク2"}, {3, "タスク3"}}
+	for _, todo := range expected {
+		app.AddTodo(todo.ID, todo.Note)
+	}
+
+	if todos := app.GetAllTodos(); !slices.Equal(todos, expected) {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", expected, todos)
+	}
+}
+
+// TestCountBy はキー関数の値ごとにTodoの件数を数えられることをテストします
+func TestCountBy(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	// ノートの文字数で分類する
+	lengthBucket := func(todo Todo) string {
+		if utf8.RuneCountInString(todo.Note) < 5 {
+			return "short"
+		}
+		return "long"
+	}
+
+	if counts := app.CountBy(lengthBucket); len(counts) != 0 {
+		t.Errorf("空のリストで空でないマップが返された: %v", counts)
+	}
+
+	app.AddTodo(1, "掃除")
+	app.AddTodo(2, "牛乳を買う")
+	app.AddTodo(3, "洗濯")
+	app.AddTodo(4, "レポートを書く")
+	app.AddTodo(5, "料理")
+
+	want := map[string]int{"short": 3, "long": 2}
+	if counts := app.CountBy(lengthBucket); !maps.Equal(counts, want) {
+		t.Errorf("期待した件数: %v, 実際: %v", want, counts)
+	}
+}
+
+// TestCountByNoteSubstring はノートに文字列を含むTodoの件数を数えられることをテストします
+func TestCountByNoteSubstring(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+	app.AddTodo(3, "パンを買う")
+	app.AddTodo(4, "友達に電話する")
+
+	for _, substr := range []string{"買う", "レポート", "洗濯", ""} {
+		// Go側で数えた件数と一致することを確認
+		want := 0
+		for _, todo := range app.GetAllTodos() {
+			if strings.Contains(todo.Note, substr) {
+				want++
+			}
+		}
+
+		if count := app.CountByNoteSubstring(substr); count != want {
+			t.Errorf("%q で期待した件数: %d, 実際: %d", substr, want, count)
+		}
+	}
+}
+
+// TestToHTML はTodoがエスケープされたHTMLの表として出力されることをテストします
+func TestToHTML(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "<script>alert('x')</script>")
+
+	out := app.ToHTML()
+
+	if strings.Contains(out, "<script>") {
+		t.Errorf("ノートがエスケープされていない: %s", out)
+	}
+
+	for _, want := range []string{
+		"<table>",
+		"<tr><td>1</td><td>牛乳を買う</td></tr>",
+		"<tr><td>2</td><td>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;</td></tr>",
+		"</table>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q が含まれていない: %s", want, out)
+		}
+	}
+}
+
+// TestTakeMatching は条件に一致するTodoを先頭からn件だけ取得できることをテストします
+func TestTakeMatching(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	// すべてのTodoが条件に一致するようにする
+	for i := range 20 {
+		app.AddTodo(int32(i), "一致するタスク")
+	}
+
+	// 述語が呼ばれた回数を記録する
+	calls := 0
+	pred := func(todo Todo) bool {
+		calls++
+		return todo.Note == "一致するタスク"
+	}
+
+	matched := app.TakeMatching(3, pred)
+	if len(matched) != 3 {
+		t.Fatalf("期待した件数: 3, 実際: %d", len(matched))
+	}
+
+	for i, todo := range matched {
+		if todo.ID != int32(i) {
+			t.Errorf("インデックス %d で期待したID: %d, 実際: %d", i, i, todo.ID)
+		}
+	}
+
+	// 3件見つかった時点で走査が打ち切られていることを確認
+	if calls != 3 {
+		t.Errorf("述語の呼び出し回数 期待: 3, 実際: %d", calls)
+	}
+
+	// nが0以下の場合は空のスライスが返ることを確認
+	if got := app.TakeMatching(0, pred); len(got) != 0 {
+		t.Errorf("n=0で空でない結果が返された: %+v", got)
+	}
+}
+
+// TestBumpRevision はリビジョンが単調増加することをテストします
+func TestBumpRevision(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	if rev := app.Revision(); rev != 0 {
+		t.Errorf("初期リビジョン 期待: 0, 実際: %d", rev)
+	}
+
+	prev := app.Revision()
+	for range 5 {
+		rev := app.BumpRevision()
+		if rev <= prev {
+			t.Errorf("リビジョンが増加していない: 前回=%d, 今回=%d", prev, rev)
+		}
+		prev = rev
+	}
+
+	if rev := app.Revision(); rev != prev {
+		t.Errorf("Revisionの結果 期待: %d, 実際: %d", prev, rev)
+	}
+}
+
+// TestBumpRevisionConcurrent は複数のgoroutineから同時にリビジョンを進めても
+// 増分が失われず、同じ値が二度返されないことをテストします
+func TestBumpRevisionConcurrent(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	const goroutines = 8
+	const bumps = 1000
+
+	results := make([][]uint64, goroutines)
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range bumps {
+				results[g] = append(results[g], app.BumpRevision())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if rev := app.Revision(); rev != goroutines*bumps {
+		t.Errorf("最終リビジョン 期待: %d, 実際: %d", goroutines*bumps, rev)
+	}
+
+	seen := make(map[uint64]bool, goroutines*bumps)
+	for _, revs := range results {
+		for _, rev := range revs {
+			if seen[rev] {
+				t.Fatalf("同じリビジョンが二度返された: %d", rev)
+			}
+			seen[rev] = true
+		}
+	}
+}
+
+// TestPageJSON は指定範囲のTodoをJSONで取得できることをテストします
+func TestPageJSON(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 10 {
+		app.AddTodo(int32(i+1), fmt.Sprintf("タスク%d", i+1))
+	}
+
+	data, err := app.PageJSON(3, 4)
+	if err != nil {
+		t.Fatalf("PageJSONでエラーが発生: %v", err)
+	}
+
+	var page struct {
+		Total int    `json:"total"`
+		Todos []Todo `json:"todos"`
+	}
+	if err := json.Unmarshal([]byte(data), &page); err != nil {
+		t.Fatalf("JSONの解析に失敗: %v, data=%s", err, data)
+	}
+
+	if page.Total != 10 {
+		t.Errorf("期待した全件数: 10, 実際: %d", page.Total)
+	}
+
+	if len(page.Todos) != 4 {
+		t.Fatalf("期待したページ件数: 4, 実際: %d", len(page.Todos))
+	}
+
+	for i, todo := range page.Todos {
+		wantID := int32(i + 4)
+		if todo.ID != wantID {
+			t.Errorf("インデックス %d で期待したID: %d, 実際: %d", i, wantID, todo.ID)
+		}
+		if want := fmt.Sprintf("タスク%d", wantID); todo.Note != want {
+			t.Errorf("インデックス %d で期待したNote: %s, 実際: %s", i, want, todo.Note)
+		}
+	}
+
+	// 負の値はエラーになることを確認
+	if _, err := app.PageJSON(-1, 2); err == nil {
+		t.Error("負のoffsetでエラーが返されなかった")
+	}
+}
+
+// TestReplaceAllIfHash はハッシュ値が一致する場合のみリストが置き換わることをテストします
+func TestReplaceAllIfHash(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "古いタスク1")
+	app.AddTodo(2, "古いタスク2")
+
+	replacement := []Todo{
+		{ID: 10, Note: "新しいタスク1"},
+		{ID: 11, Note: "新しいタスク2"},
+		{ID: 12, Note: "新しいタスク3"},
+	}
+
+	// 古いハッシュ値では置き換わらず、リストも変化しないことを確認
+	stale := app.ContentHash()
+	app.AddTodo(3, "古いタスク3")
+	if app.ReplaceAllIfHash(stale, replacement) {
+		t.Error("古いハッシュ値で置き換えが行われた")
+	}
+	if count := app.GetTodoCount(); count != 3 {
+		t.Errorf("置き換え失敗後の期待したTodo数: 3, 実際: %d", count)
+	}
+
+	// 現在のハッシュ値では置き換わることを確認
+	if !app.ReplaceAllIfHash(app.ContentHash(), replacement) {
+		t.Fatal("現在のハッシュ値で置き換えが行われなかった")
+	}
+
+	if count := app.GetTodoCount(); count != len(replacement) {
+		t.Fatalf("置き換え後の期待したTodo数: %d, 実際: %d", len(replacement), count)
+	}
+	for i, expected := range replacement {
+		todo := app.GetTodoAt(i)
+		if todo.ID != expected.ID || todo.Note != expected.Note {
+			t.Errorf("インデックス %d で期待したTodo: %+v, 実際: %+v", i, expected, *todo)
+		}
+	}
+
+	// 空のリストでも置き換えられることを確認
+	if !app.ReplaceAllIfHash(app.ContentHash(), nil) {
+		t.Error("空のリストへの置き換えが行われなかった")
+	}
+	if count := app.GetTodoCount(); count != 0 {
+		t.Errorf("空のリストへの置き換え後のTodo数: %d", count)
+	}
+}
+
+// TestTrimNote は指定したTodoのノートだけ前後の空白が取り除かれることをテストします
+func TestTrimNote(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "  \t牛乳を買う \t ")
+	app.AddTodo(2, "  レポートを書く  ")
+
+	if !app.TrimNote(1) {
+		t.Fatal("存在するIDでTrimNoteがfalseを返した")
+	}
+
+	if note := app.GetTodoAt(0).Note; note != "牛乳を買う" {
+		t.Errorf("期待したNote: %q, 実際: %q", "牛乳を買う", note)
+	}
+
+	// 他のTodoは変更されていないことを確認
+	if note := app.GetTodoAt(1).Note; note != "  レポートを書く  " {
+		t.Errorf("対象外のNoteが変更された: %q", note)
+	}
+
+	// 存在しないIDの場合はfalseが返ることを確認
+	if app.TrimNote(99) {
+		t.Error("存在しないIDでTrimNoteがtrueを返した")
+	}
+}
+
+// TestCopyTodoByID は取得したTodoがAppの解放後も有効であることをテストします
+func TestCopyTodoByID(t *testing.T) {
+	app := NewApp()
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+
+	todo, ok := app.CopyTodoByID(2)
+	if !ok {
+		t.Fatal("存在するIDのTodoが見つからなかった")
+	}
+
+	if _, ok := app.CopyTodoByID(99); ok {
+		t.Error("存在しないIDでTodoが見つかった")
+	}
+
+	// Appを解放してもコピーしたTodoは影響を受けない
+	app.Free()
+	runtime.GC()
+
+	if todo.ID != 2 {
+		t.Errorf("期待したID: 2, 実際: %d", todo.ID)
+	}
+	if todo.Note != "レポートを書く" {
+		t.Errorf("期待したNote: %s, 実際: %s", "レポートを書く", todo.Note)
+	}
+}
+
+// TestSetNoteValidator は検証関数で拒否されたノートが追加されないことをテストします
+func TestSetNoteValidator(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	// 3文字未満のノートを拒否する
+	app.SetNoteValidator(func(note string) bool {
+		return utf8.RuneCountInString(note) >= 3
+	})
+
+	if app.AddTodo(1, "短い") {
+		t.Error("3文字未満のノートが受け付けられた")
+	}
+	if err := app.TryAddTodo(1, "短い"); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("期待したエラー: %v, 実際: %v", ErrValidationFailed, err)
+	}
+	if err := app.TryAddTodo(2, "牛乳を買う"); err != nil {
+		t.Errorf("3文字以上のノートが拒否された: %v", err)
+	}
+
+	if count := app.GetTodoCount(); count != 1 {
+		t.Fatalf("期待したTodo数: 1, 実際: %d", count)
+	}
+	if todo := app.GetTodoAt(0); todo.ID != 2 {
+		t.Errorf("期待したID: 2, 実際: %d", todo.ID)
+	}
+
+	// 登録を解除すると短いノートも追加できる
+	app.SetNoteValidator(nil)
+	if !app.AddTodo(3, "短い") {
+		t.Error("検証関数の解除後に短いノートが拒否された")
+	}
+}
+
+// TestSwapContents は2つのAppのTodoリストが入れ替わることをテストします
+func TestSwapContents(t *testing.T) {
+	app1 := NewApp()
+	defer app1.Free()
+	app2 := NewApp()
+	defer app2.Free()
+
+	app1.AddTodo(1, "牛乳を買う")
+	app2.AddTodo(2, "レポートを書く")
+	app2.AddTodo(3, "友達に電話する")
+
+	app1.SwapContents(app2)
+
+	assertTodos := func(name string, app *App, expected []Todo) {
+		t.Helper()
+		if count := app.GetTodoCount(); count != len(expected) {
+			t.Fatalf("%s の期待したTodo数: %d, 実際: %d", name, len(expected), count)
+		}
+		for i, want := range expected {
+			if got := app.GetTodoAt(i); *got != want {
+				t.Errorf("%s のインデックス %d で期待したTodo: %+v, 実際: %+v", name, i, want, *got)
+			}
+		}
+	}
+
+	assertTodos("app1", app1, []Todo{{2, "レポートを書く"}, {3, "友達に電話する"}})
+	assertTodos("app2", app2, []Todo{{1, "牛乳を買う"}})
+
+	// 自分自身との入れ替えでは何も変わらない
+	app1.SwapContents(app1)
+	assertTodos("app1", app1, []Todo{{2, "レポートを書く"}, {3, "友達に電話する"}})
+}
+
+// TestTodoToJSON は指定したTodoだけをJSONで取得できることをテストします
+func TestTodoToJSON(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+
+	data, err := app.TodoToJSON(2)
+	if err != nil {
+		t.Fatalf("TodoToJSONでエラーが発生: %v", err)
+	}
+
+	var todo Todo
+	if err := json.Unmarshal([]byte(data), &todo); err != nil {
+		t.Fatalf("JSONの解析に失敗: %v, data=%s", err, data)
+	}
+	if want := (Todo{ID: 2, Note: "レポートを書く"}); todo != want {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", want, todo)
+	}
+
+	// 存在しないIDの場合はErrTodoNotFoundが返ることを確認
+	if _, err := app.TodoToJSON(99); !errors.Is(err, ErrTodoNotFound) {
+		t.Errorf("期待したエラー: %v, 実際: %v", ErrTodoNotFound, err)
+	}
+}
+
+// TestAddTemplated はテンプレートの変数が展開されたノートで追加されることをテストします
+func TestAddTemplated(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	vars := map[string]string{
+		"who":  "友達",
+		"what": "本",
+	}
+	if !app.AddTemplated(1, "{{who}}に{{what}}を返す", vars) {
+		t.Fatal("AddTemplatedが失敗した")
+	}
+	if note := app.GetTodoAt(0).Note; note != "友達に本を返す" {
+		t.Errorf("期待したNote: %s, 実際: %s", "友達に本を返す", note)
+	}
+
+	// 対応する変数がないプレースホルダーはそのまま残ることを確認
+	if !app.AddTemplated(2, "{{who}}と{{when}}に会う", vars) {
+		t.Fatal("AddTemplatedが失敗した")
+	}
+	if note := app.GetTodoAt(1).Note; note != "友達と{{when}}に会う" {
+		t.Errorf("期待したNote: %s, 実際: %s", "友達と{{when}}に会う", note)
+	}
+
+	// 変数なしでも追加できることを確認
+	if !app.AddTemplated(3, "{{who}}", nil) || app.GetTodoAt(2).Note != "{{who}}" {
+		t.Errorf("変数なしのテンプレートが正しく追加されなかった: %+v", app.GetTodoAt(2))
+	}
+}
+
+// TestNoteAllocStats はノートのサイズ統計が正しく計算されることをテストします
+func TestNoteAllocStats(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	if stats := app.NoteAllocStats(); stats != (AllocStats{}) {
+		t.Errorf("空のリストで期待した統計: %+v, 実際: %+v", AllocStats{}, stats)
+	}
+
+	app.AddTodo(1, "abcd")     // 4バイト
+	app.AddTodo(2, "a")        // 1バイト
+	app.AddTodo(3, "牛乳を買う")    // 15バイト
+	app.AddTodo(4, "abcdefgh") // 8バイト
+
+	want := AllocStats{
+		Count:        4,
+		TotalBytes:   28,
+		MinBytes:     1,
+		MaxBytes:     15,
+		AverageBytes: 7,
+	}
+	if stats := app.NoteAllocStats(); stats != want {
+		t.Errorf("期待した統計: %+v, 実際: %+v", want, stats)
+	}
+}
+
+// TestStreamBatches はTodoが指定件数ずつ順番にsinkへ渡されることをテストします
+func TestStreamBatches(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 25 {
+		app.AddTodo(int32(i), fmt.Sprintf("タスク%d", i))
+	}
+
+	var sizes []int
+	var streamed []Todo
+	err := app.StreamBatches(10, func(batch []Todo) error {
+		sizes = append(sizes, len(batch))
+		streamed = append(streamed, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamBatchesでエラーが発生: %v", err)
+	}
+
+	if want := []int{10, 10, 5}; !slices.Equal(sizes, want) {
+		t.Errorf("期待したバッチサイズ: %v, 実際: %v", want, sizes)
+	}
+	for i, todo := range streamed {
+		if todo.ID != int32(i) || todo.Note != fmt.Sprintf("タスク%d", i) {
+			t.Errorf("インデックス %d で不正なTodo: %+v", i, todo)
+		}
+	}
+}
+
+// TestStreamBatchesStopsOnError はsinkがエラーを返すと中断することをテストします
+func TestStreamBatchesStopsOnError(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 50 {
+		app.AddTodo(int32(i), "タスク")
+	}
+
+	errStop := errors.New("停止")
+	calls := 0
+	err := app.StreamBatches(10, func(batch []Todo) error {
+		calls++
+		if calls == 2 {
+			return errStop
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errStop) {
+		t.Errorf("期待したエラー: %v, 実際: %v", errStop, err)
+	}
+	if calls != 2 {
+		t.Errorf("sinkの呼び出し回数 期待: 2, 実際: %d", calls)
+	}
+}
+
+// TestStreamBatchesConsistentView は並行して追加されてもTodoが抜けや重複なく渡されることをテストします
+func TestStreamBatchesConsistentView(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.SetSortedInsert(true)
+	for i := range 100 {
+		app.AddTodo(int32(i), "タスク")
+	}
+
+	// 先頭に挿入し続けて、オフセットで走査すると同じTodoが重複するようにする
+	started := make(chan struct{})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for id := int32(-1); ; id-- {
+			app.AddTodo(id, "割り込み")
+			if id == -1 {
+				close(started)
+			}
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+	}()
+	<-started
+
+	var streamed []int32
+	err := app.StreamBatches(7, func(batch []Todo) error {
+		for _, todo := range batch {
+			streamed = append(streamed, todo.ID)
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	close(done)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatalf("StreamBatchesでエラーが発生: %v", err)
+	}
+	// 同じ時点のTodoリストは連続したIDが昇順に並んだものになる
+	for i := 1; i < len(streamed); i++ {
+		if streamed[i] != streamed[i-1]+1 {
+			t.Fatalf("インデックス %d でIDが連続していません: %v", i, streamed)
+		}
+	}
+	if len(streamed) < 100 || streamed[len(streamed)-1] != 99 {
+		t.Errorf("0から99までのIDを期待しましたが、実際: %v", streamed)
+	}
+}
+
+// TestFirstUnsortedByID はIDの順序が崩れている最初の位置を取得できることをテストします
+func TestFirstUnsortedByID(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for _, id := range []int32{1, 2, 3, 4, 5} {
+		app.AddTodo(id, "タスク")
+	}
+	if index := app.FirstUnsortedByID(); index != -1 {
+		t.Errorf("昇順のリストで期待した結果: -1, 実際: %d", index)
+	}
+
+	inverted := NewApp()
+	defer inverted.Free()
+
+	for _, id := range []int32{1, 2, 4, 3, 5} {
+		inverted.AddTodo(id, "タスク")
+	}
+	if index := inverted.FirstUnsortedByID(); index != 2 {
+		t.Errorf("期待したインデックス: 2, 実際: %d", index)
+	}
+}
+
+// TestNoteAtTruncated はノートが文字単位で切り詰められることをテストします
+func TestNoteAtTruncated(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "短い")
+
+	// バイト単位ではなく文字単位で切り詰められることを確認
+	if note := app.NoteAtTruncated(0, 3); note != "牛乳を" {
+		t.Errorf("期待したNote: %s, 実際: %s", "牛乳を", note)
+	}
+
+	// 短いノートは切り詰められないことを確認
+	if note := app.NoteAtTruncated(1, 10); note != "短い" {
+		t.Errorf("期待したNote: %s, 実際: %s", "短い", note)
+	}
+
+	// 保存されているノートは変更されていないことを確認
+	if note := app.GetTodoAt(0).Note; note != "牛乳を買う" {
+		t.Errorf("保存されているNoteが変更された: %s", note)
+	}
+
+	if note := app.NoteAtTruncated(5, 3); note != "" {
+		t.Errorf("範囲外のインデックスで空でない値が返された: %s", note)
+	}
+}
+
+// TestSnapshotWithHash は取得したリストとハッシュ値が対応していることをテストします
+func TestSnapshotWithHash(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 10 {
+		app.AddTodo(int32(i), fmt.Sprintf("タスク%d", i))
+
+		todos, hash := app.SnapshotWithHash()
+		if len(todos) != i+1 {
+			t.Fatalf("期待したTodo数: %d, 実際: %d", i+1, len(todos))
+		}
+
+		// スナップショットの内容を別のAppに復元し、ハッシュ値を計算し直す
+		restored := NewApp()
+		if !restored.ReplaceAllIfHash(restored.ContentHash(), todos) {
+			t.Fatal("スナップショットの復元に失敗")
+		}
+		if recomputed := restored.ContentHash(); recomputed != hash {
+			t.Errorf("%d 件目で再計算したハッシュ値が一致しない: 期待=%d, 実際=%d", i+1, hash, recomputed)
+		}
+		restored.Free()
+	}
+}
+
+// TestSnapshotWithHashConcurrentWriter は別のgoroutineが変更している最中でも
+// スナップショットとハッシュ値が対応していることをテストします
+func TestSnapshotWithHashConcurrentWriter(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			app.AddTodo(int32(i), fmt.Sprintf("タスク%d", i))
+			app.TrimNote(int32(i / 2))
+			app.UpsertTodos([]Todo{{ID: int32(i / 3), Note: fmt.Sprintf("更新%d", i)}})
+		}
+	}()
+
+	restored := NewApp()
+	defer restored.Free()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		todos, hash := app.SnapshotWithHash()
+		if !restored.ReplaceAllIfHash(restored.ContentHash(), todos) {
+			t.Fatal("スナップショットの復元に失敗")
+		}
+		if recomputed := restored.ContentHash(); recomputed != hash {
+			t.Fatalf("%d 件のスナップショットで再計算したハッシュ値が一致しない: 期待=%d, 実際=%d", len(todos), hash, recomputed)
+		}
+	}
+}
+
+// TestUpsertTodos は既存のIDは更新され、新しいIDは追加されることをテストします
+func TestUpsertTodos(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+	app.AddTodo(3, "友達に電話する")
+	app.AddTodo(4, "掃除する")
+
+	// 半分は既存のIDと重複する
+	inserted, updated := app.UpsertTodos([]Todo{
+		{ID: 2, Note: "レポートを提出する"},
+		{ID: 4, Note: "部屋を掃除する"},
+		{ID: 5, Note: "本を読む"},
+		{ID: 6, Note: "散歩する"},
+	})
+
+	if inserted != 2 || updated != 2 {
+		t.Errorf("期待した件数: 追加=2, 更新=2, 実際: 追加=%d, 更新=%d", inserted, updated)
+	}
+
+	want := []Todo{
+		{1, "牛乳を買う"},
+		{2, "レポートを提出する"},
+		{3, "友達に電話する"},
+		{4, "部屋を掃除する"},
+		{5, "本を読む"},
+		{6, "散歩する"},
+	}
+	if todos := app.GetAllTodos(); !slices.Equal(todos, want) {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", want, todos)
+	}
+}
+
+// TestUpsertTodosValidator は検証関数が拒否したTodoが更新・追加されず件数にも数えられないことをテストします
+func TestUpsertTodosValidator(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+	app.SetNoteValidator(func(note string) bool { return note != "" })
+
+	inserted, updated := app.UpsertTodos([]Todo{
+		{ID: 1, Note: ""},
+		{ID: 2, Note: "レポートを提出する"},
+		{ID: 3, Note: ""},
+		{ID: 4, Note: "本を読む"},
+	})
+
+	if inserted != 1 || updated != 1 {
+		t.Errorf("期待した件数: 追加=1, 更新=1, 実際: 追加=%d, 更新=%d", inserted, updated)
+	}
+
+	want := []Todo{
+		{1, "牛乳を買う"},
+		{2, "レポートを提出する"},
+		{4, "本を読む"},
+	}
+	if todos := app.GetAllTodos(); !slices.Equal(todos, want) {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", want, todos)
+	}
+}
+
+// TestUpsertTodosSortedInsert はソート挿入が有効なとき新しいIDがソート位置に追加されることをテストします
+func TestUpsertTodosSortedInsert(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.SetSortedInsert(true)
+	app.AddTodo(2, "レポートを書く")
+	app.AddTodo(5, "本を読む")
+
+	inserted, updated := app.UpsertTodos([]Todo{
+		{ID: 4, Note: "掃除する"},
+		{ID: 1, Note: "牛乳を買う"},
+		{ID: 5, Note: "本を返す"},
+		{ID: 3, Note: "友達に電話する"},
+	})
+
+	if inserted != 3 || updated != 1 {
+		t.Errorf("期待した件数: 追加=3, 更新=1, 実際: 追加=%d, 更新=%d", inserted, updated)
+	}
+
+	want := []Todo{
+		{1, "牛乳を買う"},
+		{2, "レポートを書く"},
+		{3, "友達に電話する"},
+		{4, "掃除する"},
+		{5, "本を返す"},
+	}
+	if todos := app.GetAllTodos(); !slices.Equal(todos, want) {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", want, todos)
+	}
+}
+
+// TestNotePtrAt は内部ポインタ経由で読み取ったノートが正しいことをテストします
+func TestNotePtrAt(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "")
+
+	for i := range app.GetTodoCount() {
+		ptr, n := app.NotePtrAt(i)
+		if ptr == nil {
+			t.Fatalf("インデックス %d でnilポインタが返された", i)
+		}
+
+		// ポインタが有効なうちにGoの文字列へコピーする
+		note := strings.Clone(unsafe.String((*byte)(ptr), n))
+		if want := app.GetTodoAt(i).Note; note != want {
+			t.Errorf("インデックス %d で期待したNote: %q, 実際: %q", i, want, note)
+		}
+	}
+
+	if ptr, n := app.NotePtrAt(2); ptr != nil || n != 0 {
+		t.Errorf("範囲外のインデックスで期待した結果: nil, 0, 実際: %v, %d", ptr, n)
+	}
+}
+
+// TestTodoHashByID はTodoごとのハッシュ値が自身の変更でのみ変わることをテストします
+func TestTodoHashByID(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "レポートを書く")
+
+	hash, ok := app.TodoHashByID(1)
+	if !ok {
+		t.Fatal("存在するIDのハッシュ値が取得できなかった")
+	}
+
+	// 他のTodoを変更・追加してもハッシュ値は変わらない
+	app.UpsertTodos([]Todo{{ID: 2, Note: "レポートを提出する"}})
+	app.AddTodo(3, "友達に電話する")
+	if got, _ := app.TodoHashByID(1); got != hash {
+		t.Errorf("無関係な変更でハッシュ値が変わった: 期待=%d, 実際=%d", hash, got)
+	}
+
+	// ノートを変更するとハッシュ値が変わる
+	app.UpsertTodos([]Todo{{ID: 1, Note: "パンを買う"}})
+	if got, _ := app.TodoHashByID(1); got == hash {
+		t.Error("ノートを変更してもハッシュ値が変わらなかった")
+	}
+
+	if _, ok := app.TodoHashByID(99); ok {
+		t.Error("存在しないIDでハッシュ値が取得できた")
+	}
+}
+
+// TestJSONLRoundTrip はJSONL形式で出力したTodoを読み込み直せることをテストします
+func TestJSONLRoundTrip(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	expected := []Todo{
+		{1, "牛乳を買う"},
+		{2, "改行\nを含む"},
+		{3, `"引用"付き`},
+	}
+	for _, todo := range expected {
+		app.AddTodo(todo.ID, todo.Note)
+	}
+
+	data, err := app.ToJSONL()
+	if err != nil {
+		t.Fatalf("ToJSONLでエラーが発生: %v", err)
+	}
+
+	// 各行が独立したJSONとして解析でき、件数が一致することを確認
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("期待した行数: %d, 実際: %d, data=%q", len(expected), len(lines), data)
+	}
+	for i, line := range lines {
+		var todo Todo
+		if err := json.Unmarshal([]byte(line), &todo); err != nil {
+			t.Fatalf("%d 行目の解析に失敗: %v", i+1, err)
+		}
+		if todo != expected[i] {
+			t.Errorf("%d 行目で期待したTodo: %+v, 実際: %+v", i+1, expected[i], todo)
+		}
+	}
+
+	loaded := NewApp()
+	defer loaded.Free()
+
+	if err := loaded.LoadFromJSONL(data); err != nil {
+		t.Fatalf("LoadFromJSONLでエラーが発生: %v", err)
+	}
+	if todos := loaded.GetAllTodos(); !slices.Equal(todos, expected) {
+		t.Errorf("期待したTodo: %+v, 実際: %+v", expected, todos)
+	}
+
+	// 不正な行を含む場合はエラーになり、リストは変更されない
+	if err := loaded.LoadFromJSONL(data + "{不正な行}\n"); err == nil {
+		t.Error("不正なJSONLでエラーが返されなかった")
+	}
+	if count := loaded.GetTodoCount(); count != len(expected) {
+		t.Errorf("読み込み失敗後の期待したTodo数: %d, 実際: %d", len(expected), count)
+	}
+}
+
+// TestCallCounts は一括取得の方がFFIの呼び出し回数が少ないことをテストします
+func TestCallCounts(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	const n = 20
+	for i := range n {
+		app.AddTodo(int32(i), "タスク")
+	}
+
+	SetInstrumentation(true)
+	defer SetInstrumentation(false)
+
+	ResetCallCounts()
+	app.GetAllTodos()
+	bulk := CallCounts()
+
+	ResetCallCounts()
+	for i := range app.GetTodoCount() {
+		app.GetTodoAt(i)
+	}
+	loop := CallCounts()
+
+	if bulk["get_all_todos"] != 1 {
+		t.Errorf("get_all_todos の期待した呼び出し回数: 1, 実際: %d", bulk["get_all_todos"])
+	}
+	if bulk["get_todo_note_at"] != 0 {
+		t.Errorf("一括取得で get_todo_note_at が呼び出された: %d", bulk["get_todo_note_at"])
+	}
+	if loop["get_todo_note_at"] != n || loop["get_todo_id_at"] != n {
+		t.Errorf("ループでの期待した呼び出し回数: %d, 実際: %v", n, loop)
+	}
+
+	total := func(counts map[string]uint64) (sum uint64) {
+		for _, count := range counts {
+			sum += count
+		}
+		return sum
+	}
+	if total(bulk) >= total(loop) {
+		t.Errorf("一括取得の呼び出し回数が少なくない: 一括=%v, ループ=%v", bulk, loop)
+	}
+
+	// 無効にした後は記録されない
+	SetInstrumentation(false)
+	ResetCallCounts()
+	app.GetAllTodos()
+	if counts := CallCounts(); len(counts) != 0 {
+		t.Errorf("計測を無効にした後に記録された: %v", counts)
+	}
+}
+
+// TestSetSortedInsert はソート挿入を有効にするとIDの昇順が保たれることをテストします
+func TestSetSortedInsert(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.SetSortedInsert(true)
+
+	for _, id := range []int32{7, 2, 9, 2, 5, 0, 8} {
+		app.AddTodo(id, fmt.Sprintf("タスク%d", id))
+
+		ids := make([]int32, 0)
+		for _, todo := range app.GetAllTodos() {
+			ids = append(ids, todo.ID)
+		}
+		if !slices.IsSorted(ids) {
+			t.Errorf("ID %d を追加した後に昇順になっていない: %v", id, ids)
+		}
+		if !app.IsSortedByID() {
+			t.Errorf("ID %d を追加した後に IsSortedByID が false を返した", id)
+		}
+	}
+
+	if got := app.GetTodoCount(); got != 7 {
+		t.Errorf("期待したTodo数: 7, 実際: %d", got)
+	}
+	if todo := app.GetTodoAt(0); todo.ID != 0 || todo.Note != "タスク0" {
+		t.Errorf("先頭のTodoが期待と異なる: %+v", todo)
+	}
+
+	// 無効に戻すと末尾に追加される
+	app.SetSortedInsert(false)
+	app.AddTodo(1, "タスク1")
+	if app.IsSortedByID() {
+		t.Error("ソート挿入を無効にした後も昇順のまま")
+	}
+}
+
+// TestFilterByAnyNote はいずれかの文字列を含むTodoが重複なく返されることをテストします
+func TestFilterByAnyNote(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを焼く")
+	app.AddTodo(3, "牛乳とパンを買う")
+	app.AddTodo(4, "掃除する")
+
+	todos := app.FilterByAnyNote([]string{"牛乳", "パン"})
+	expected := []Todo{
+		{ID: 1, Note: "牛乳を買う"},
+		{ID: 2, Note: "パンを焼く"},
+		{ID: 3, Note: "牛乳とパンを買う"},
+	}
+	if !slices.Equal(todos, expected) {
+		t.Errorf("期待した結果: %v, 実際: %v", expected, todos)
+	}
+
+	if todos := app.FilterByAnyNote([]string{"洗濯"}); len(todos) != 0 {
+		t.Errorf("一致しない文字列で結果が返された: %v", todos)
+	}
+	if todos := app.FilterByAnyNote(nil); len(todos) != 0 {
+		t.Errorf("空の入力で結果が返された: %v", todos)
+	}
+}
+
+// TestFindByExactNote は部分一致ではなく完全一致のTodoだけが返されることをテストします
+func TestFindByExactNote(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "milk")
+	app.AddTodo(2, "buy milk")
+	app.AddTodo(3, "milk")
+	app.AddTodo(4, "milk ")
+
+	todos := app.FindByExactNote("milk")
+	expected := []Todo{{ID: 1, Note: "milk"}, {ID: 3, Note: "milk"}}
+	if !slices.Equal(todos, expected) {
+		t.Errorf("期待した結果: %v, 実際: %v", expected, todos)
+	}
+
+	if todos := app.FindByExactNote("mil"); len(todos) != 0 {
+		t.Errorf("前方一致で結果が返された: %v", todos)
+	}
+}
+
+// TestFilterByAllNotes はすべての文字列を含むTodoだけが返されることをテストします
+func TestFilterByAllNotes(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "牛乳とパンを買う")
+	app.AddTodo(3, "パンを焼く")
+
+	todos := app.FilterByAllNotes([]string{"牛乳", "パン"})
+	expected := []Todo{{ID: 2, Note: "牛乳とパンを買う"}}
+	if !slices.Equal(todos, expected) {
+		t.Errorf("期待した結果: %v, 実際: %v", expected, todos)
+	}
+
+	// 空の入力ではすべてのTodoが返される
+	if todos := app.FilterByAllNotes(nil); !slices.Equal(todos, app.GetAllTodos()) {
+		t.Errorf("空の入力で期待した結果: %v, 実際: %v", app.GetAllTodos(), todos)
+	}
+}
+
+// TestChecksumFile は保存したファイルの破損をチェックサムで検出できることをテストします
+func TestChecksumFile(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを買う")
+
+	data, err := app.ToJSONL()
+	if err != nil {
+		t.Fatalf("JSONLへの変換に失敗: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "todos.jsonl")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("ファイルの保存に失敗: %v", err)
+	}
+
+	before, err := ChecksumFile(path)
+	if err != nil {
+		t.Fatalf("チェックサムの計算に失敗: %v", err)
+	}
+	if again, _ := ChecksumFile(path); again != before {
+		t.Errorf("同じ内容でチェックサムが変わった: %d != %d", again, before)
+	}
+
+	// 1バイト書き換えるとチェックサムが変わる
+	corrupted := []byte(data)
+	corrupted[len(corrupted)/2] ^= 0x01
+	if err := os.WriteFile(path, corrupted, 0o644); err != nil {
+		t.Fatalf("ファイルの書き換えに失敗: %v", err)
+	}
+	after, err := ChecksumFile(path)
+	if err != nil {
+		t.Fatalf("チェックサムの計算に失敗: %v", err)
+	}
+	if after == before {
+		t.Error("ファイルを破損させてもチェックサムが変わらない")
+	}
+
+	if _, err := ChecksumFile(filepath.Join(t.TempDir(), "missing.jsonl")); err == nil {
+		t.Error("存在しないファイルでエラーが返されない")
+	}
+}
+
+// TestCloneMatching は条件に一致したTodoだけを持つ独立したAppが作られることをテストします
+func TestCloneMatching(t *testing.T) {
+	app := NewApp()
+
+	app.AddTodo(1, "[急ぎ] 請求書を送る")
+	app.AddTodo(2, "本を読む")
+	app.AddTodo(3, "[急ぎ] 電話を返す")
+	app.AddTodo(3, "[急ぎ] メールを返す")
+
+	urgent := func(todo Todo) bool {
+		return strings.HasPrefix(todo.Note, "[急ぎ]")
+	}
+	clone := app.CloneMatching(urgent)
+
+	expected := []Todo{
+		{ID: 1, Note: "[急ぎ] 請求書を送る"},
+		{ID: 3, Note: "[急ぎ] 電話を返す"},
+		{ID: 3, Note: "[急ぎ] メールを返す"},
+	}
+	if got := clone.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待したクローンの内容: %v, 実際: %v", expected, got)
+	}
+	if got := app.GetTodoCount(); got != 4 {
+		t.Errorf("元のAppのTodo数が変わった: %d", got)
+	}
+
+	// 先に元のAppを解放しても、クローンは独立して使える
+	app.Free()
+	clone.AddTodo(4, "[急ぎ] 追加")
+	if got := clone.GetTodoAt(0); got == nil || *got != expected[0] {
+		t.Errorf("元のAppを解放した後のクローンの内容が期待と異なる: %v", got)
+	}
+	clone.Free()
+
+	// 一致しない場合は空のAppが返される
+	empty := NewApp()
+	defer empty.Free()
+	none := empty.CloneMatching(urgent)
+	defer none.Free()
+	if got := none.GetTodoCount(); got != 0 {
+		t.Errorf("期待したTodo数: 0, 実際: %d", got)
+	}
+}
+
+// TestSortedInsertPos はソート済みのリストで挿入位置が求められることをテストします
+func TestSortedInsertPos(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for _, id := range []int32{10, 20, 30} {
+		app.AddTodo(id, fmt.Sprintf("タスク%d", id))
+	}
+
+	tests := []struct {
+		id       int32
+		expected int
+	}{
+		{id: 5, expected: 0},
+		{id: 15, expected: 1},
+		{id: 35, expected: 3},
+	}
+	for _, tt := range tests {
+		if got := app.SortedInsertPos(tt.id); got != tt.expected {
+			t.Errorf("ID %d の期待した挿入位置: %d, 実際: %d", tt.id, tt.expected, got)
+		}
+	}
+
+	if got := app.GetTodoCount(); got != 3 {
+		t.Errorf("挿入位置の取得でTodo数が変わった: %d", got)
+	}
+}
+
+// TestMsgPackRoundTrip はMessagePack形式で書き出したTodoを読み込めることをテストします
+func TestMsgPackRoundTrip(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(-5, "")
+	app.AddTodo(70000, strings.Repeat("長いノート", 20))
+
+	data, err := app.ToMsgPack()
+	if err != nil {
+		t.Fatalf("MessagePackへの変換に失敗: %v", err)
+	}
+
+	restored := NewApp()
+	defer restored.Free()
+	if err := restored.LoadFromMsgPack(data); err != nil {
+		t.Fatalf("MessagePackの読み込みに失敗: %v", err)
+	}
+	if got, expected := restored.GetAllTodos(), app.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待した内容: %v, 実際: %v", expected, got)
+	}
+
+	// 壊れたデータでは変更されない
+	if err := restored.LoadFromMsgPack(data[:len(data)-1]); err == nil {
+		t.Error("途中で切れたデータでエラーが返されない")
+	}
+	if err := restored.LoadFromMsgPack(nil); err == nil {
+		t.Error("空のデータでエラーが返されない")
+	}
+
+	// 新しいスキーマバージョンのデータは読み込まない
+	var newer bytes.Buffer
+	enc := msgpack.NewEncoder(&newer)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(msgPackDocument{SchemaVersion: SchemaVersion() + 1, Todos: []Todo{}}); err != nil {
+		t.Fatalf("MessagePackへの変換に失敗: %v", err)
+	}
+	if err := restored.LoadFromMsgPack(newer.Bytes()); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("期待したエラー: %v, 実際: %v", ErrUnsupportedSchema, err)
+	}
+	if got := restored.GetTodoCount(); got != 3 {
+		t.Errorf("読み込みに失敗した後のTodo数が変わった: %d", got)
+	}
+
+	// 空のリストも読み込める
+	empty := NewApp()
+	defer empty.Free()
+	emptyData, err := empty.ToMsgPack()
+	if err != nil {
+		t.Fatalf("空のリストのMessagePackへの変換に失敗: %v", err)
+	}
+	if err := restored.LoadFromMsgPack(emptyData); err != nil || restored.GetTodoCount() != 0 {
+		t.Errorf("空のリストの読み込みが期待と異なる: err=%v, 件数=%d", err, restored.GetTodoCount())
+	}
+}
+
+// msgPackDocumentはToMsgPackが書き出すMessagePackの構造を表します
+// キーはToJSONと同じなので、jsonタグをMessagePackのキーとして使います
+type msgPackDocument struct {
+	SchemaVersion int    `json:"schema_version"`
+	Todos         []Todo `json:"todos"`
+}
+
+// TestMsgPackFormat はRust以外の実装でもToMsgPackの出力を解釈できることをテストします
+func TestMsgPackFormat(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	expected := []Todo{
+		{ID: 1, Note: "牛乳を買う"},
+		{ID: -40, Note: strings.Repeat("a", 40)},
+		{ID: 300, Note: ""},
+	}
+	for _, todo := range expected {
+		app.AddTodo(todo.ID, todo.Note)
+	}
+
+	data, err := app.ToMsgPack()
+	if err != nil {
+		t.Fatalf("MessagePackへの変換に失敗: %v", err)
+	}
+
+	reader := bytes.NewReader(data)
+	dec := msgpack.NewDecoder(reader)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+
+	var document msgPackDocument
+	if err := dec.Decode(&document); err != nil {
+		t.Fatalf("MessagePackのデコードに失敗: %v", err)
+	}
+	if reader.Len() != 0 {
+		t.Errorf("デコード後に余分なバイトが残った: %d バイト", reader.Len())
+	}
+	if document.SchemaVersion != SchemaVersion() {
+		t.Errorf("期待したスキーマバージョン: %d, 実際: %d", SchemaVersion(), document.SchemaVersion)
+	}
+	if !slices.Equal(document.Todos, expected) {
+		t.Errorf("期待した内容: %v, 実際: %v", expected, document.Todos)
+	}
+}
+
+// TestWithCrossingStats は一括取得の方がFFIの呼び出し回数が少なく計測されることをテストします
+func TestWithCrossingStats(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	const n = 50
+	for i := range n {
+		app.AddTodo(int32(i), fmt.Sprintf("タスク%d", i))
+	}
+
+	bulk := app.WithCrossingStats(func() {
+		app.GetAllTodos()
+	})
+	loop := app.WithCrossingStats(func() {
+		for i := range app.GetTodoCount() {
+			app.GetTodoAt(i)
+		}
+	})
+
+	if bulk != 2 {
+		t.Errorf("一括取得の期待した呼び出し回数: 2, 実際: %d", bulk)
+	}
+	if loop < 2*n {
+		t.Errorf("ループの呼び出し回数が少なすぎる: %d", loop)
+	}
+	if bulk*10 > loop {
+		t.Errorf("一括取得の呼び出し回数が十分に少なくない: 一括=%d, ループ=%d", bulk, loop)
+	}
+
+	// 終了後は計測が元の無効な状態に戻る
+	ResetCallCounts()
+	app.GetAllTodos()
+	if counts := CallCounts(); len(counts) != 0 {
+		t.Errorf("終了後も計測が有効なまま: %v", counts)
+	}
+}
+
+// TestTimingStats は計測を有効にした間に呼び出した関数の実行時間が記録されることをテストします
+func TestTimingStats(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for i := range 200 {
+		app.AddTodo(int32(i), strings.Repeat("タスク", 10))
+	}
+
+	SetTiming(true)
+	defer SetTiming(false)
+
+	ResetTimingStats()
+	app.GetAllTodos()
+	app.ContentHash()
+	if _, err := app.ToJSONL(); err != nil {
+		t.Fatalf("JSONLへの変換に失敗: %v", err)
+	}
+	stats := TimingStats()
+
+	for _, name := range []string{"get_all_todos", "content_hash", "todos_to_jsonl"} {
+		if stats[name] <= 0 {
+			t.Errorf("%s の実行時間が記録されていない: %v", name, stats)
+		}
+	}
+	if _, ok := stats["add_todo"]; ok {
+		t.Errorf("計測を有効にする前の関数が記録された: %v", stats)
+	}
+
+	// 無効にした後は記録されない
+	SetTiming(false)
+	ResetTimingStats()
+	app.GetAllTodos()
+	if stats := TimingStats(); len(stats) != 0 {
+		t.Errorf("計測を無効にした後に記録された: %v", stats)
+	}
+}
+
+// TestDedupByIDKeepLast は同じIDのTodoのうち最後のものが残ることをテストします
+func TestDedupByIDKeepLast(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う（古い）")
+	app.AddTodo(2, "掃除する")
+	app.AddTodo(1, "牛乳を買う（中間）")
+	app.AddTodo(3, "散歩する")
+	app.AddTodo(1, "牛乳を買う（最新）")
+
+	if removed := app.DedupByIDKeepLast(); removed != 2 {
+		t.Errorf("期待した削除件数: 2, 実際: %d", removed)
+	}
+
+	expected := []Todo{
+		{ID: 2, Note: "掃除する"},
+		{ID: 3, Note: "散歩する"},
+		{ID: 1, Note: "牛乳を買う（最新）"},
+	}
+	if got := app.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待した結果: %v, 実際: %v", expected, got)
+	}
+
+	if removed := app.DedupByIDKeepLast(); removed != 0 {
+		t.Errorf("重複がない状態で削除された: %d", removed)
+	}
+}
+
+// TestAllPointers は返されたポインタを書き換えても保存されたTodoが変わらないことをテストします
+func TestAllPointers(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを買う")
+
+	pointers := app.AllPointers()
+	if len(pointers) != 2 {
+		t.Fatalf("期待した件数: 2, 実際: %d", len(pointers))
+	}
+	if *pointers[0] != (Todo{ID: 1, Note: "牛乳を買う"}) || *pointers[1] != (Todo{ID: 2, Note: "パンを買う"}) {
+		t.Errorf("返されたTodoが期待と異なる: %v, %v", *pointers[0], *pointers[1])
+	}
+
+	pointers[0].ID = 100
+	pointers[0].Note = "書き換えたノート"
+	if got := app.GetTodoAt(0); got == nil || *got != (Todo{ID: 1, Note: "牛乳を買う"}) {
+		t.Errorf("返されたポインタの書き換えで保存されたTodoが変わった: %v", got)
+	}
+
+	empty := NewApp()
+	defer empty.Free()
+	if pointers := empty.AllPointers(); len(pointers) != 0 {
+		t.Errorf("空のAppで結果が返された: %v", pointers)
+	}
+}
+
+// TestImportJSONWithProgress は読み込み中に進捗が単調に増加して通知されることをテストします
+func TestImportJSONWithProgress(t *testing.T) {
+	todos := make([]Todo, 500)
+	for i := range todos {
+		todos[i] = Todo{ID: int32(i), Note: fmt.Sprintf("タスク%d", i)}
+	}
+	data, err := json.Marshal(struct {
+		SchemaVersion int    `json:"schema_version"`
+		Todos         []Todo `json:"todos"`
+	}{SchemaVersion(), todos})
+	if err != nil {
+		t.Fatalf("JSONへの変換に失敗: %v", err)
+	}
+
+	app := NewApp()
+	defer app.Free()
+
+	var dones []int
+	err = app.ImportJSONWithProgress(string(data), func(done, total int) {
+		if total != len(todos) {
+			t.Errorf("期待した全体の件数: %d, 実際: %d", len(todos), total)
+		}
+		dones = append(dones, done)
+	})
+	if err != nil {
+		t.Fatalf("読み込みに失敗: %v", err)
+	}
+
+	if len(dones) < 2 {
+		t.Errorf("進捗が途中で通知されていない: %v", dones)
+	}
+	for i := 1; i < len(dones); i++ {
+		if dones[i] <= dones[i-1] {
+			t.Errorf("進捗が単調に増加していない: %v", dones)
+			break
+		}
+	}
+	if len(dones) > 0 && dones[len(dones)-1] != len(todos) {
+		t.Errorf("最後の進捗が全体の件数と一致しない: %d", dones[len(dones)-1])
+	}
+	if got := app.GetAllTodos(); !slices.Equal(got, todos) {
+		t.Errorf("読み込んだ内容が期待と異なる: %d件", len(got))
+	}
+
+	// コールバックなしでも読み込め、ToJSONの出力もそのまま読み込める
+	source := NewApp()
+	defer source.Free()
+	source.AddTodo(1, "タスク")
+	exported, err := source.ToJSON()
+	if err != nil {
+		t.Fatalf("JSONへの変換に失敗: %v", err)
+	}
+	if err := app.ImportJSONWithProgress(exported, nil); err != nil {
+		t.Errorf("コールバックなしの読み込みに失敗: %v", err)
+	}
+
+	// 解析に失敗した場合やスキーマバージョンが異なる場合は変更されない
+	if err := app.ImportJSONWithProgress(`{"schema_version":1,"todos":[{"id":1,`, nil); err == nil {
+		t.Error("不正なJSONでエラーが返されない")
+	}
+	if err := app.ImportJSONWithProgress(`[{"id":1,"note":"タスク"}]`, nil); err == nil {
+		t.Error("スキーマバージョンのない配列でエラーが返されない")
+	}
+	newer := fmt.Sprintf(`{"schema_version":%d,"todos":[]}`, SchemaVersion()+1)
+	if err := app.ImportJSONWithProgress(newer, nil); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("期待したエラー: %v, 実際: %v", ErrUnsupportedSchema, err)
+	}
+	if got := app.GetTodoCount(); got != 1 {
+		t.Errorf("読み込みに失敗した後のTodo数が変わった: %d", got)
+	}
+}
+
+// TestHasOversizedNote は上限を超えるノートとその位置を検出できることをテストします
+func TestHasOversizedNote(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "短い")
+	app.AddTodo(2, strings.Repeat("長", 100))
+	app.AddTodo(3, "短い")
+
+	// "長"はUTF-8で3バイト
+	if found, index := app.HasOversizedNote(299); !found || index != 1 {
+		t.Errorf("期待した結果: true, 1, 実際: %v, %d", found, index)
+	}
+	if found, index := app.HasOversizedNote(300); found || index != -1 {
+		t.Errorf("期待した結果: false, -1, 実際: %v, %d", found, index)
+	}
+}
+
+// TestMergeWith はIDが衝突した場合にresolveの結果で更新されることをテストします
+func TestMergeWith(t *testing.T) {
+	dst := NewApp()
+	defer dst.Free()
+	src := NewApp()
+	defer src.Free()
+
+	dst.AddTodo(1, "牛乳")
+	dst.AddTodo(2, "掃除する（リビングとキッチン）")
+	src.AddTodo(1, "牛乳を2本買う")
+	src.AddTodo(2, "掃除する")
+	src.AddTodo(3, "散歩する")
+
+	var calls int
+	longer := func(a, b Todo) Todo {
+		calls++
+		if utf8.RuneCountInString(b.Note) > utf8.RuneCountInString(a.Note) {
+			return b
+		}
+		return a
+	}
+	dst.MergeWith(src, longer)
+
+	expected := []Todo{
+		{ID: 1, Note: "牛乳を2本買う"},
+		{ID: 2, Note: "掃除する（リビングとキッチン）"},
+		{ID: 3, Note: "散歩する"},
+	}
+	if got := dst.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待したマージ結果: %v, 実際: %v", expected, got)
+	}
+	if calls != 2 {
+		t.Errorf("resolveの期待した呼び出し回数: 2, 実際: %d", calls)
+	}
+	if got := src.GetTodoCount(); got != 3 {
+		t.Errorf("srcのTodo数が変わった: %d", got)
+	}
+}
+
+// TestDiffPatch はパッチを適用した結果が比較先と同じ内容になることをテストします
+func TestDiffPatch(t *testing.T) {
+	base := NewApp()
+	defer base.Free()
+	other := NewApp()
+	defer other.Free()
+
+	base.AddTodo(1, "牛乳を買う")
+	base.AddTodo(2, "パンを買う")
+	base.AddTodo(3, "掃除する")
+	other.AddTodo(1, "牛乳を買う")
+	other.AddTodo(3, "掃除する（済）")
+	other.AddTodo(4, "散歩する")
+
+	patch, err := base.DiffPatch(other)
+	if err != nil {
+		t.Fatalf("差分の取得に失敗: %v", err)
+	}
+
+	var doc struct {
+		Removed []int32 `json:"removed"`
+		Changed []Todo  `json:"changed"`
+		Added   []Todo  `json:"added"`
+	}
+	if err := json.Unmarshal([]byte(patch), &doc); err != nil {
+		t.Fatalf("パッチがJSONとして不正: %v", err)
+	}
+	if !slices.Equal(doc.Removed, []int32{2}) ||
+		!slices.Equal(doc.Changed, []Todo{{ID: 3, Note: "掃除する（済）"}}) ||
+		!slices.Equal(doc.Added, []Todo{{ID: 4, Note: "散歩する"}}) {
+		t.Errorf("パッチの内容が期待と異なる: %s", patch)
+	}
+
+	if err := base.ApplyPatch(patch); err != nil {
+		t.Fatalf("パッチの適用に失敗: %v", err)
+	}
+	if base.ContentHash() != other.ContentHash() {
+		t.Errorf("パッチ適用後の内容が一致しない: %v, %v", base.GetAllTodos(), other.GetAllTodos())
+	}
+
+	// 適用済みのパッチは再適用できず、内容も変わらない
+	if err := base.ApplyPatch(patch); err == nil {
+		t.Error("適用済みのパッチでエラーが返されない")
+	}
+	if base.ContentHash() != other.ContentHash() {
+		t.Error("適用に失敗したパッチで内容が変わった")
+	}
+}
+
+// TestValidatePatch はパッチを検証してもTodoリストが変更されないことをテストします
+func TestValidatePatch(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを買う")
+	before := app.ContentHash()
+
+	valid := `{"removed":[2],"changed":[{"id":1,"note":"牛乳を2本買う"}],"added":[{"id":3,"note":"散歩する"}]}`
+	if err := app.ValidatePatch(valid); err != nil {
+		t.Errorf("適用できるパッチでエラーが返された: %v", err)
+	}
+	if app.ContentHash() != before {
+		t.Error("適用できるパッチの検証で内容が変わった")
+	}
+
+	missing := `{"changed":[{"id":1,"note":"牛乳を2本買う"},{"id":9,"note":"存在しない"}]}`
+	if err := app.ValidatePatch(missing); err == nil {
+		t.Error("存在しないIDを指すパッチでエラーが返されない")
+	}
+	if app.ContentHash() != before {
+		t.Error("適用できないパッチの検証で内容が変わった")
+	}
+
+	// 検証の結果はApplyPatchと一致する
+	if err := app.ApplyPatch(valid); err != nil {
+		t.Errorf("検証に成功したパッチの適用に失敗: %v", err)
+	}
+}
+
+// TestLoadFromJSONSchemaVersion はスキーマバージョンが異なるJSONが拒否されることをテストします
+func TestLoadFromJSONSchemaVersion(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを買う")
+
+	data, err := app.ToJSON()
+	if err != nil {
+		t.Fatalf("JSONへの変換に失敗: %v", err)
+	}
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal([]byte(data), &header); err != nil || header.SchemaVersion != SchemaVersion() {
+		t.Errorf("書き出したスキーマバージョンが期待と異なる: %s", data)
+	}
+
+	// 現在のバージョンは通常どおり読み込める
+	restored := NewApp()
+	defer restored.Free()
+	if err := restored.LoadFromJSON(data); err != nil {
+		t.Fatalf("現在のバージョンの読み込みに失敗: %v", err)
+	}
+	if got, expected := restored.GetAllTodos(), app.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待した内容: %v, 実際: %v", expected, got)
+	}
+
+	// 新しいバージョンはErrUnsupportedSchemaで拒否され、内容は変わらない
+	bumped := strings.Replace(data,
+		fmt.Sprintf(`"schema_version":%d`, SchemaVersion()),
+		fmt.Sprintf(`"schema_version":%d`, SchemaVersion()+1), 1)
+	if err := restored.LoadFromJSON(bumped); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("期待したエラー: %v, 実際: %v", ErrUnsupportedSchema, err)
+	}
+	if err := restored.LoadFromJSON(`{"todos":[`); err == nil || errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("不正なJSONで期待と異なるエラー: %v", err)
+	}
+	if got := restored.GetTodoCount(); got != 2 {
+		t.Errorf("読み込みに失敗した後のTodo数が変わった: %d", got)
+	}
+}
+
+// TestMigrateJSON は古い形式のJSONを変換すると読み込めるようになることをテストします
+func TestMigrateJSON(t *testing.T) {
+	// スキーマバージョン導入前はTodoの配列をそのまま保存していた
+	legacy := `[{"id":1,"note":"牛乳を買う"},{"id":2,"note":"パンを買う"}]`
+
+	app := NewApp()
+	defer app.Free()
+	if err := app.LoadFromJSON(legacy); err == nil {
+		t.Error("古い形式をそのまま読み込めてしまった")
+	}
+
+	migrated, err := MigrateJSON(legacy)
+	if err != nil {
+		t.Fatalf("変換に失敗: %v", err)
+	}
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal([]byte(migrated), &header); err != nil || header.SchemaVersion != SchemaVersion() {
+		t.Errorf("変換後のスキーマバージョンが期待と異なる: %s", migrated)
+	}
+
+	if err := app.LoadFromJSON(migrated); err != nil {
+		t.Fatalf("変換後のJSONの読み込みに失敗: %v", err)
+	}
+	expected := []Todo{{ID: 1, Note: "牛乳を買う"}, {ID: 2, Note: "パンを買う"}}
+	if got := app.GetAllTodos(); !slices.Equal(got, expected) {
+		t.Errorf("期待した内容: %v, 実際: %v", expected, got)
+	}
+
+	// 現在の形式はそのまま、新しい形式は変換できない
+	if again, err := MigrateJSON(migrated); err != nil || again != migrated {
+		t.Errorf("現在の形式の変換結果が期待と異なる: %q, %v", again, err)
+	}
+	newer := fmt.Sprintf(`{"schema_version":%d,"todos":[]}`, SchemaVersion()+1)
+	if _, err := MigrateJSON(newer); err == nil {
+		t.Error("新しいスキーマバージョンでエラーが返されない")
+	}
+}
+
+// TestTodosWithIDBetween は境界を含む範囲のIDのTodoが返されることをテストします
+func TestTodosWithIDBetween(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	for _, id := range []int32{42, 3, 17, 8, 25, 10} {
+		app.AddTodo(id, fmt.Sprintf("タスク%d", id))
+	}
+
+	todos := app.TodosWithIDBetween(8, 25)
+	expected := []Todo{
+		{ID: 17, Note: "タスク17"},
+		{ID: 8, Note: "タスク8"},
+		{ID: 25, Note: "タスク25"},
+		{ID: 10, Note: "タスク10"},
+	}
+	if !slices.Equal(todos, expected) {
+		t.Errorf("期待した結果: %v, 実際: %v", expected, todos)
+	}
+
+	if todos := app.TodosWithIDBetween(26, 41); len(todos) != 0 {
+		t.Errorf("範囲内のIDがないのに結果が返された: %v", todos)
+	}
+	if todos := app.TodosWithIDBetween(25, 8); len(todos) != 0 {
+		t.Errorf("下限が上限より大きいのに結果が返された: %v", todos)
+	}
+}
+
+// TestWithTodo は同時に呼び出したWithTodoの読み取り・変更・書き戻しが失われないことをテストします
+// 別のgoroutineが先頭にTodoを挿入して位置をずらしても、対象のTodoに書き戻されることも確認します
+// go test -race で実行することを想定しています
+func TestWithTodo(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.SetSortedInsert(true)
+	app.AddTodo(1, "0")
+	app.AddTodo(2, "他のTodo")
+
+	const goroutines = 8
+	const increments = 50
+	const inserts = 100
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range inserts {
+			app.AddTodo(0, "先頭に挿入")
+		}
+	}()
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				app.WithTodo(1, func(todo *Todo) bool {
+					n, err := strconv.Atoi(todo.Note)
+					if err != nil {
+						t.Errorf("ノートが数値ではない: %q", todo.Note)
+						return false
+					}
+					todo.Note = strconv.Itoa(n + 1)
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	expected := strconv.Itoa(goroutines * increments)
+	if got, ok := app.CopyTodoByID(1); !ok || got.Note != expected {
+		t.Errorf("期待したノート: %s, 実際: %v", expected, got)
+	}
+	if got, ok := app.CopyTodoByID(2); !ok || got.Note != "他のTodo" {
+		t.Errorf("対象外のTodoが変わった: %v", got)
+	}
+	if got := app.CountByNoteSubstring("先頭に挿入"); got != inserts {
+		t.Errorf("挿入したTodoの数 期待: %d, 実際: %d", inserts, got)
+	}
+
+	// falseを返した場合や存在しないIDの場合は書き戻さない
+	if app.WithTodo(1, func(todo *Todo) bool {
+		todo.Note = "破棄される変更"
+		return false
+	}) {
+		t.Error("fnがfalseを返したのにtrueが返された")
+	}
+	if app.WithTodo(99, func(*Todo) bool {
+		t.Error("存在しないIDでfnが呼び出された")
+		return true
+	}) {
+		t.Error("存在しないIDでtrueが返された")
+	}
+
+	// IDの変更と、検証関数が拒否したノートは書き戻さない
+	if app.WithTodo(1, func(todo *Todo) bool {
+		todo.ID = 3
+		return true
+	}) {
+		t.Error("IDを変更したのにtrueが返された")
+	}
+	app.SetNoteValidator(func(note string) bool { return note != "" })
+	if app.WithTodo(1, func(todo *Todo) bool {
+		todo.Note = ""
+		return true
+	}) {
+		t.Error("検証関数が拒否したのにtrueが返された")
+	}
+	if got, ok := app.CopyTodoByID(1); !ok || got.Note != expected {
+		t.Errorf("書き戻していない変更が反映された: %v", got)
+	}
+}
+
+// TestGetByIDs は結果が要求したIDの順序と位置で返されることをテストします
+func TestGetByIDs(t *testing.T) {
+	app := NewApp()
+	defer app.Free()
+
+	app.AddTodo(1, "牛乳を買う")
+	app.AddTodo(2, "パンを買う")
+	app.AddTodo(3, "掃除する")
+
+	todos := app.GetByIDs([]int32{3, 99, 1, 1, -5, 2})
+	expected := []*Todo{
+		{ID: 3, Note: "掃除する"},
+		nil,
+		{ID: 1, Note: "牛乳を買う"},
+		{ID: 1, Note: "牛乳を買う"},
+		nil,
+		{ID: 2, Note: "パンを買う"},
+	}
+	if len(todos) != len(expected) {
+		t.Fatalf("期待した件数: %d, 実際: %d", len(expected), len(todos))
+	}
+	for i := range expected {
+		switch {
+		case expected[i] == nil && todos[i] != nil:
+			t.Errorf("%d番目は見つからないはずが見つかった: %v", i, *todos[i])
+		case expected[i] != nil && (todos[i] == nil || *todos[i] != *expected[i]):
+			t.Errorf("%d番目の期待した結果: %v, 実際: %v", i, *expected[i], todos[i])
+		}
+	}
+
+	if todos := app.GetByIDs(nil); len(todos) != 0 {
+		t.Errorf("空の入力で結果が返された: %v", todos)
+	}
+}
+
 func formatBytes(bytes uint64) (float64, string) {
 	// 人間が読みやすい単位に変換
 	var unit string
@@ -61,13 +61,47 @@ typedef struct Vec_Todo {
 } Vec_Todo_t;
 
 /** \brief
- *  Todoアプリケーションの状態を管理する構造体
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
  *
- *  複数のTodoアイテムを管理し、FFIを通じてC/Go言語からも利用可能です。
+ *  # C layout (for some given type T)
  *
- *  # フィールド
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
+ *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
+ */
+typedef struct slice_ref_Todo {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    Todo_t const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_Todo_t;
+
+
+#include <stdbool.h>
+
+/** \brief
+ *  Todoアプリケーションの状態を管理する構造体
  *
- *  * `todos` - Todo項目のコレクション（FFI互換のrepr_c::Vec型）
+ *  複数のTodoアイテムを管理し、FFIを通じてC/Go言語からも利用可能です。
+ *  C/Go言語からは不透明な型として扱われ、内部の状態には `App::read` と
+ *  `App::write` で取得するロックを通してアクセスします。
+ *  読み取りだけを行うFFI関数は共有ロックを、変更を行うFFI関数は排他ロックを取るため、
+ *  同じインスタンスを複数のスレッドから同時に操作できます。
  *
  *  # 使用例
  *
@@ -76,37 +110,488 @@ typedef struct Vec_Todo {
  *  use safer_ffi::prelude::*;
  *
  *  // 空のAppインスタンスを作成
- *  let mut app = App::default();
- *  assert_eq!(app.todos.len(), 0);
+ *  let app = App::default();
+ *  assert_eq!(app.read().todos.len(), 0);
  *
  *  // CStringを作成してchar_p::Refに変換
  *  let note = std::ffi::CString::new("牛乳を買う").unwrap();
  *  let note_ref = char_p::Ref::from(note.as_ref());
  *
  *  // Todoを追加
- *  add_todo(&mut app, 1, note_ref);
+ *  add_todo(&app, 1, note_ref);
+ *  ```
+ */
+typedef struct App App_t;
+
+/** \brief
+ *  `with_todo` のコールバックが書き戻すノートを受け取る構造体
+ *
+ *  C/Go言語からは不透明な型として扱われ、`todo_edit_set_note` でノートを設定します。
+ */
+typedef struct TodoEdit TodoEdit_t;
+
+/** \brief
+ *  `try_add_todo` の結果
+ */
+/** \remark Has the same ABI as `int32_t` **/
+#ifdef DOXYGEN
+typedef
+#endif
+enum AddStatus {
+    /** \brief
+     *  追加に成功した
+     */
+    ADD_STATUS_ADDED,
+    /** \brief
+     *  登録された検証関数がノートを拒否した
+     */
+    ADD_STATUS_VALIDATION_FAILED,
+}
+#ifndef DOXYGEN
+; typedef int32_t
+#endif
+AddStatus_t;
+
+/** \brief
+ *  FFI経由でTodoをまとめて受け取るための借用版構造体
+ *
+ *  文字列は呼び出し側が所有しており、Rust側では必要に応じてコピーして保持します。
+ *
+ *  # フィールド
+ *
+ *  * `id` - Todo項目の一意識別子
+ *  * `note` - Todo項目の内容を表す文字列（FFI互換のchar_p::Ref型）
+ */
+typedef struct TodoRef {
+    /** <No documentation available> */
+    int32_t id;
+
+    /** <No documentation available> */
+    char const * note;
+} TodoRef_t;
+
+/** \brief
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
+ *
+ *  # C layout (for some given type T)
+ *
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
+ *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
+ */
+typedef struct slice_ref_TodoRef {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    TodoRef_t const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_TodoRef_t;
+
+/** \brief
+ *  ノートのテンプレートに埋め込む変数を表す借用版構造体
+ *
+ *  # フィールド
+ *
+ *  * `key` - テンプレート中の `{{key}}` に対応する変数名
+ *  * `value` - 置換する値
+ */
+typedef struct TemplateVar {
+    /** <No documentation available> */
+    char const * key;
+
+    /** <No documentation available> */
+    char const * value;
+} TemplateVar_t;
+
+/** \brief
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
+ *
+ *  # C layout (for some given type T)
+ *
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
  *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
  */
-typedef struct App {
+typedef struct slice_ref_TemplateVar {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    TemplateVar_t const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_TemplateVar_t;
+
+/** \brief
+ *  ノートとして確保されている文字列のサイズに関する統計
+ *
+ *  サイズはいずれもNUL終端を除いたバイト数です。
+ *
+ *  # フィールド
+ *
+ *  * `count` - ノートの数
+ *  * `total_bytes` - ノートの合計バイト数
+ *  * `min_bytes` - 最も短いノートのバイト数（ノートがない場合は0）
+ *  * `max_bytes` - 最も長いノートのバイト数（ノートがない場合は0）
+ *  * `average_bytes` - ノートの平均バイト数（ノートがない場合は0）
+ */
+typedef struct NoteAllocStats {
+    /** <No documentation available> */
+    size_t count;
+
+    /** <No documentation available> */
+    size_t total_bytes;
+
+    /** <No documentation available> */
+    size_t min_bytes;
+
+    /** <No documentation available> */
+    size_t max_bytes;
+
+    /** <No documentation available> */
+    double average_bytes;
+} NoteAllocStats_t;
+
+/** \brief
+ *  Todoリストのコピーと、そのハッシュ値の組
+ *
+ *  # フィールド
+ *
+ *  * `todos` - Todoリストのコピー（`free_todo_vec` で解放します）
+ *  * `hash` - コピー元のリストから計算した `content_hash` の値
+ */
+typedef struct TodoSnapshot {
     /** <No documentation available> */
     Vec_Todo_t todos;
-} App_t;
 
+    /** <No documentation available> */
+    uint64_t hash;
+} TodoSnapshot_t;
 
-#include <stdbool.h>
+/** \brief
+ *  `upsert_todos` で追加・更新したTodoの件数
+ *
+ *  # フィールド
+ *
+ *  * `inserted` - 新しく追加したTodoの件数
+ *  * `updated` - 既存のTodoのノートを更新した件数
+ */
+typedef struct UpsertCounts {
+    /** <No documentation available> */
+    size_t inserted;
+
+    /** <No documentation available> */
+    size_t updated;
+} UpsertCounts_t;
+
+/** \brief
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
+ *
+ *  # C layout (for some given type T)
+ *
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
+ *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
+ */
+typedef struct slice_ref_uint8 {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    uint8_t const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_uint8_t;
+
+/** \brief
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
+ *
+ *  # C layout (for some given type T)
+ *
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
+ *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
+ */
+typedef struct slice_ref_int32 {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    int32_t const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_int32_t;
+
+/** \brief
+ *  `&'lt [T]` but with a guaranteed `#[repr(C)]` layout.
+ *
+ *  # C layout (for some given type T)
+ *
+ *  ```c
+ *  typedef struct {
+ *  // Cannot be NULL
+ *  T * ptr;
+ *  size_t len;
+ *  } slice_T;
+ *  ```
+ *
+ *  # Nullable pointer?
+ *
+ *  If you want to support the above typedef, but where the `ptr` field is
+ *  allowed to be `NULL` (with the contents of `len` then being irrelevant),
+ *  use the `Option< slice_ptr<_> >` type.
+ */
+typedef struct slice_ref_char_const_ptr {
+    /** \brief
+     *  Pointer to the first element (if any).
+     */
+    char const * const * ptr;
+
+    /** \brief
+     *  Element count
+     */
+    size_t len;
+} slice_ref_char_const_ptr_t;
+
+/** \brief
+ *  `load_todos_from_json` などの読み込み結果
+ */
+/** \remark Has the same ABI as `int32_t` **/
+#ifdef DOXYGEN
+typedef
+#endif
+enum LoadStatus {
+    /** \brief
+     *  読み込みに成功した
+     */
+    LOAD_STATUS_OK,
+    /** \brief
+     *  データの形式が不正
+     */
+    LOAD_STATUS_MALFORMED,
+    /** \brief
+     *  対応していないスキーマバージョン
+     */
+    LOAD_STATUS_UNSUPPORTED_SCHEMA,
+}
+#ifndef DOXYGEN
+; typedef int32_t
+#endif
+LoadStatus_t;
+
+/** \brief
+ *  FFI関数ごとの呼び出し回数
+ *
+ *  # フィールド
+ *
+ *  * `name` - FFI関数の名前
+ *  * `count` - 計測を有効にしてからの呼び出し回数
+ */
+typedef struct CallCount {
+    /** <No documentation available> */
+    char * name;
+
+    /** <No documentation available> */
+    uint64_t count;
+} CallCount_t;
+
+/** \brief
+ *  Same as [`Vec<T>`][`rust::Vec`], but with guaranteed `#[repr(C)]` layout
+ */
+typedef struct Vec_CallCount {
+    /** <No documentation available> */
+    CallCount_t * ptr;
+
+    /** <No documentation available> */
+    size_t len;
+
+    /** <No documentation available> */
+    size_t cap;
+} Vec_CallCount_t;
+
+/** \brief
+ *  FFI関数ごとの累積実行時間
+ *
+ *  # フィールド
+ *
+ *  * `name` - FFI関数の名前
+ *  * `nanos` - 計測を有効にしてからRust側で費やした時間の合計（ナノ秒）
+ */
+typedef struct CallTiming {
+    /** <No documentation available> */
+    char * name;
+
+    /** <No documentation available> */
+    uint64_t nanos;
+} CallTiming_t;
+
+/** \brief
+ *  Same as [`Vec<T>`][`rust::Vec`], but with guaranteed `#[repr(C)]` layout
+ */
+typedef struct Vec_CallTiming {
+    /** <No documentation available> */
+    CallTiming_t * ptr;
+
+    /** <No documentation available> */
+    size_t len;
+
+    /** <No documentation available> */
+    size_t cap;
+} Vec_CallTiming_t;
+
+/** \brief
+ *  Same as [`Vec<T>`][`rust::Vec`], but with guaranteed `#[repr(C)]` layout
+ */
+typedef struct Vec_uint8 {
+    /** <No documentation available> */
+    uint8_t * ptr;
+
+    /** <No documentation available> */
+    size_t len;
+
+    /** <No documentation available> */
+    size_t cap;
+} Vec_uint8_t;
+
+/** \brief
+ *  IDによるTodoの検索結果
+ *
+ *  # フィールド
+ *
+ *  * `id` - 検索したID
+ *  * `note` - 見つかったTodoのノート（見つからなかった場合はNULL）
+ */
+typedef struct TodoLookup {
+    /** <No documentation available> */
+    int32_t id;
+
+    /** <No documentation available> */
+    char * note;
+} TodoLookup_t;
+
+/** \brief
+ *  Same as [`Vec<T>`][`rust::Vec`], but with guaranteed `#[repr(C)]` layout
+ */
+typedef struct Vec_TodoLookup {
+    /** <No documentation available> */
+    TodoLookup_t * ptr;
+
+    /** <No documentation available> */
+    size_t len;
+
+    /** <No documentation available> */
+    size_t cap;
+} Vec_TodoLookup_t;
+
+/** \brief
+ *  テンプレートの変数を展開したノートでTodoを追加します
+ *
+ *  `template` 中の `{{key}}` は `vars` の同じ `key` を持つ値に置き換えられます。
+ *  対応する変数がないプレースホルダーは `{{key}}` のまま残ります。
+ *  展開後のノートは `add_todo` と同様に検証関数の対象になります。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoを追加するアプリケーションインスタンスへの参照
+ *  * `id` - 追加するTodoの一意識別子
+ *  * `template` - `{{key}}` 形式のプレースホルダーを含むテンプレート
+ *  * `vars` - プレースホルダーに埋め込む変数の一覧
+ *
+ *  # 戻り値
+ *
+ *  追加が成功した場合は`true`、失敗した場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, TemplateVar, add_templated_todo};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let template = CString::new("{{who}}に電話する").unwrap();
+ *  let key = CString::new("who").unwrap();
+ *  let value = CString::new("友達").unwrap();
+ *  let vars = [TemplateVar {
+ *  key: char_p::Ref::from(key.as_ref()),
+ *  value: char_p::Ref::from(value.as_ref()),
+ *  }];
+ *
+ *  let template = char_p::Ref::from(template.as_ref());
+ *  assert!(add_templated_todo(&app, 1, template, c_slice::Ref::from(&vars[..])));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "友達に電話する");
+ *  ```
+ */
+bool
+add_templated_todo (
+    App_t const * app,
+    int32_t id,
+    char const * template,
+    slice_ref_TemplateVar_t vars);
 
 /** \brief
  *  Todoをアプリケーションに追加します
  *
  *  # 引数
  *
- *  * `app` - Todoを追加するアプリケーションインスタンスへの可変参照
+ *  * `app` - Todoを追加するアプリケーションインスタンスへの参照
  *  * `id` - 追加するTodoの一意識別子
  *  * `note` - Todoの内容を表す文字列（FFI互換のchar_p::Ref型）
  *
  *  # 戻り値
  *
  *  追加が成功した場合は`true`、失敗した場合は`false`を返します。
+ *  `set_note_validator` で登録した検証関数がノートを拒否した場合も`false`を返します。
  *
  *  # 使用例
  *
@@ -117,11 +602,11 @@ typedef struct App {
  *  use safer_ffi::prelude::*;
  *  use std::ffi::CString;
  *
- *  let mut app = App::default();
+ *  let app = App::default();
  *  let note = CString::new("重要なタスク").unwrap();
  *  let note_ref = char_p::Ref::from(note.as_ref());
  *
- *  let success = add_todo(&mut app, 1, note_ref);
+ *  let success = add_todo(&app, 1, note_ref);
  *  assert!(success);
  *  ```
  *
@@ -140,10 +625,47 @@ typedef struct App {
  */
 bool
 add_todo (
-    App_t * app,
+    App_t const * app,
     int32_t id,
     char const * note);
 
+/** \brief
+ *  複数のTodoをまとめてアプリケーションに追加します
+ *
+ *  `todos` の順に `add_todo` と同じ規則で追加します。検証関数が拒否したノートのTodoは追加せず、
+ *  残りのTodoの追加は続けます。ソート挿入が有効な場合は、それぞれIDの昇順を保つ位置へ挿入します。
+ *  Todoリストの再構築は1回だけなので、`add_todo` を繰り返し呼び出すより効率的です。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `todos` - 追加するTodoの一覧（文字列はコピーして保持されます）
+ *
+ *  # 戻り値
+ *
+ *  追加したTodoの件数
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, TodoRef, add_todos, get_todo_count};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  let note = char_p::Ref::from(note.as_ref());
+ *  let todos = [TodoRef { id: 1, note }, TodoRef { id: 2, note }];
+ *
+ *  assert_eq!(add_todos(&app, c_slice::Ref::from(&todos[..])), 2);
+ *  assert_eq!(get_todo_count(&app), 2);
+ *  ```
+ */
+size_t
+add_todos (
+    App_t const * app,
+    slice_ref_TodoRef_t todos);
+
 /** \brief
  *  アプリケーションのメモリを解放します
  *
@@ -210,181 +732,2038 @@ app_free (
 App_t *
 app_new (void);
 
-/** <No documentation available> */
-void
-free_char_p_box (
+/** \brief
+ *  JSONのパッチをTodoリストに適用します
+ *
+ *  `todos_diff_patch_json` が返す形式のパッチを読み込み、`removed` のIDを持つTodoをすべて削除し、
+ *  `changed` のIDを持つ先頭のTodoのノートを更新してから、`added` のTodoを末尾に追加します。
+ *  パッチの形式が不正な場合や、現在の状態に適用できない場合（`removed` や `changed` が存在しないIDを指す、
+ *  `added` が残るTodoとIDが重複するなど）は、Todoリストを変更しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `patch` - パッチのJSON文字列
+ *
+ *  # 戻り値
+ *
+ *  適用に成功した場合は`true`、失敗した場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, apply_todos_patch_json};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  let patch = CString::new(r#"{"changed":[{"id":1,"note":"更新"}]}"#).unwrap();
+ *  assert!(apply_todos_patch_json(&app, char_p::Ref::from(patch.as_ref())));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "更新");
+ *  ```
+ */
+bool
+apply_todos_patch_json (
+    App_t const * app,
+    char const * patch);
+
+/** \brief
+ *  アプリケーションのリビジョンを1つ進めます
+ *
+ *  リビジョンはTodoの変更とは無関係に、利用者が任意のタイミングで進めるカウンタです。
+ *  アトミックにインクリメントするため、複数のスレッドから同時に呼び出しても
+ *  同じ値が二度返されることはありません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  インクリメント後のリビジョン
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, bump_revision, get_revision};
+ *
+ *  let app = App::default();
+ *  assert_eq!(bump_revision(&app), 1);
+ *  assert_eq!(bump_revision(&app), 2);
+ *  assert_eq!(get_revision(&app), 2);
+ *  ```
+ */
+uint64_t
+bump_revision (
+    App_t const * app);
+
+/** \brief
+ *  ファイルの内容からチェックサムを計算します
+ *
+ *  `content_hash` と同じFNV-1a方式でファイルのバイト列をハッシュします。
+ *  保存したファイルの破損を、読み込み前に検出するために使います。
+ *
+ *  # 引数
+ *
+ *  * `path` - チェックサムを計算するファイルのパス
+ *  * `checksum` - 計算したチェックサムの書き込み先
+ *
+ *  # 戻り値
+ *
+ *  計算に成功した場合は`true`、ファイルを読み込めなかった場合は`false`を返します。
+ *  失敗した場合、`checksum` は変更しません。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::checksum_file;
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let path = std::env::temp_dir().join("checksum_file_example.jsonl");
+ *  std::fs::write(&path, "{\"id\":1,\"note\":\"タスク\"}\n").unwrap();
+ *
+ *  let cpath = CString::new(path.to_str().unwrap()).unwrap();
+ *  let mut checksum = 0;
+ *  assert!(checksum_file(char_p::Ref::from(cpath.as_ref()), &mut checksum));
+ *  # std::fs::remove_file(&path).unwrap();
+ *  ```
+ */
+bool
+checksum_file (
+    char const * path,
+    uint64_t * checksum);
+
+/** \brief
+ *  Todoリスト全体の内容からハッシュ値を計算します
+ *
+ *  各TodoのIDとノートを順番に反映するため、内容または並び順が変わるとハッシュ値も変わります。
+ *  計算方式は固定されているので、別プロセスで計算した値とも比較できます。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  Todoリストのハッシュ値
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, content_hash};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let before = content_hash(&app);
+ *
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert_ne!(content_hash(&app), before);
+ *  ```
+ */
+uint64_t
+content_hash (
+    App_t const * app);
+
+/** \brief
+ *  ノートに指定した文字列を含むTodoの件数を取得します
+ *
+ *  一致したTodoはコピーせず、件数だけを数えます。空文字列はすべてのノートに一致します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `substr` - ノートから検索する文字列
+ *
+ *  # 戻り値
+ *
+ *  ノートに `substr` を含むTodoの件数
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, count_todos_with_note_substring};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for note in ["牛乳を買う", "パンを買う", "掃除する"] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let substr = CString::new("買う").unwrap();
+ *  assert_eq!(count_todos_with_note_substring(&app, char_p::Ref::from(substr.as_ref())), 2);
+ *  ```
+ */
+size_t
+count_todos_with_note_substring (
+    App_t const * app,
+    char const * substr);
+
+/** \brief
+ *  現在のスキーマバージョンを取得します
+ *
+ *  # 戻り値
+ *
+ *  `todos_to_json` が書き出し、`load_todos_from_json` が読み込める形式のバージョン
+ */
+uint32_t
+current_schema_version (void);
+
+/** \brief
+ *  同じIDのTodoを、それぞれ最後のものだけ残して削除します
+ *
+ *  後から追加されたTodoほど新しいデータとみなし、各IDについて最も後ろにあるTodoを残します。
+ *  残ったTodoは元の並び順を保ち、削除したTodoのノートは解放されます。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  削除したTodoの件数
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, dedup_todos_by_id_keep_last};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for note in ["古いノート", "新しいノート"] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  assert_eq!(dedup_todos_by_id_keep_last(&app), 1);
+ *  assert_eq!(app.read().todos[0].note.to_str(), "新しいノート");
+ *  ```
+ */
+size_t
+dedup_todos_by_id_keep_last (
+    App_t const * app);
+
+/** \brief
+ *  ノートに複数の文字列をすべて含むTodoを取得します
+ *
+ *  `substrs` が空の場合はすべてのTodoが一致します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `substrs` - ノートから検索する文字列の配列
+ *
+ *  # 戻り値
+ *
+ *  条件に一致したTodoのコピー（元の順序を保持）。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, filter_todos_by_all_notes, free_todo_vec};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for (id, note) in [(1, "牛乳を買う"), (2, "牛乳を飲む")] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let milk = CString::new("牛乳").unwrap();
+ *  let buy = CString::new("買う").unwrap();
+ *  let substrs = [char_p::Ref::from(milk.as_ref()), char_p::Ref::from(buy.as_ref())];
+ *  let todos = filter_todos_by_all_notes(&app, c_slice::Ref::from(&substrs[..]));
+ *  assert_eq!(todos.len(), 1);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+filter_todos_by_all_notes (
+    App_t const * app,
+    slice_ref_char_const_ptr_t substrs);
+
+/** \brief
+ *  ノートに複数の文字列のいずれかを含むTodoを取得します
+ *
+ *  1つのTodoが複数の文字列を含む場合も、結果には1回だけ含まれます。
+ *  `substrs` が空の場合は空のVecを返します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `substrs` - ノートから検索する文字列の配列
+ *
+ *  # 戻り値
+ *
+ *  条件に一致したTodoのコピー（元の順序を保持）。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, filter_todos_by_any_note, free_todo_vec};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for (id, note) in [(1, "牛乳を買う"), (2, "掃除する"), (3, "散歩する")] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let milk = CString::new("牛乳").unwrap();
+ *  let walk = CString::new("散歩").unwrap();
+ *  let substrs = [char_p::Ref::from(milk.as_ref()), char_p::Ref::from(walk.as_ref())];
+ *  let todos = filter_todos_by_any_note(&app, c_slice::Ref::from(&substrs[..]));
+ *  assert_eq!(todos.len(), 2);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+filter_todos_by_any_note (
+    App_t const * app,
+    slice_ref_char_const_ptr_t substrs);
+
+/** \brief
+ *  指定IDのTodoのインデックスを取得します
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `id` - 検索するTodoの識別子
+ *
+ *  # 戻り値
+ *
+ *  最初に見つかったTodoのインデックス、見つからない場合は-1を返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, find_todo_index};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 7, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert_eq!(find_todo_index(&app, 7), 0);
+ *  assert_eq!(find_todo_index(&app, 8), -1);
+ *  ```
+ */
+int64_t
+find_todo_index (
+    App_t const * app,
+    int32_t id);
+
+/** \brief
+ *  ノートが指定した文字列と完全に一致するTodoを取得します
+ *
+ *  部分一致ではなく、ノート全体が `note` と等しいTodoだけが対象になります。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `note` - 比較する文字列
+ *
+ *  # 戻り値
+ *
+ *  ノートが `note` と等しいTodoのコピー（元の順序を保持）。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, find_todos_by_exact_note, free_todo_vec};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for note in ["牛乳", "牛乳を買う"] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let note = CString::new("牛乳").unwrap();
+ *  let todos = find_todos_by_exact_note(&app, char_p::Ref::from(note.as_ref()));
+ *  assert_eq!(todos.len(), 1);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+find_todos_by_exact_note (
+    App_t const * app,
+    char const * note);
+
+/** \brief
+ *  ノートのバイト数が上限を超える最初のTodoの位置を取得します
+ *
+ *  バイト数はUTF-8でのバイト数で、終端のNUL文字は含みません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `max_bytes` - ノートのバイト数の上限
+ *
+ *  # 戻り値
+ *
+ *  ノートが `max_bytes` バイトを超える最初のTodoのインデックス、ない場合は-1を返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, first_oversized_note_index};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for note in ["短い", "とても長いノート"] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  assert_eq!(first_oversized_note_index(&app, 10), 1);
+ *  assert_eq!(first_oversized_note_index(&app, 100), -1);
+ *  ```
+ */
+int64_t
+first_oversized_note_index (
+    App_t const * app,
+    size_t max_bytes);
+
+/** \brief
+ *  IDの昇順になっていない最初の位置を取得します
+ *
+ *  `todos[i].id > todos[i + 1].id` となる最初の `i` を返します。
+ *  同じIDが隣り合っている場合は昇順とみなします。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  最初に順序が崩れている位置のインデックス、IDの昇順に並んでいる場合は-1を返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, first_unsorted_by_id};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  for id in [1, 3, 2] {
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  assert_eq!(first_unsorted_by_id(&app), 1);
+ *  ```
+ */
+int64_t
+first_unsorted_by_id (
+    App_t const * app);
+
+/** \brief
+ *  `todos_to_msgpack` などで取得したバイト列を解放します
+ *
+ *  # 引数
+ *
+ *  * `_bytes` - 解放するバイト列
+ */
+void
+free_byte_vec (
+    Vec_uint8_t _bytes);
+
+/** \brief
+ *  `get_call_counts` で取得したVecを解放します
+ *
+ *  # 引数
+ *
+ *  * `_counts` - 解放する呼び出し回数の一覧
+ */
+void
+free_call_counts (
+    Vec_CallCount_t _counts);
+
+/** <No documentation available> */
+void
+free_char_p_box (
     char * _boxed);
 
 /** \brief
- *  アプリケーション内のTodoの数を取得します
+ *  `get_timing_stats` で取得したVecを解放します
+ *
+ *  # 引数
+ *
+ *  * `_stats` - 解放する累積実行時間の一覧
+ */
+void
+free_timing_stats (
+    Vec_CallTiming_t _stats);
+
+/** \brief
+ *  `get_todos_by_ids` で取得したVecを解放します
+ *
+ *  # 引数
+ *
+ *  * `_lookups` - 解放する検索結果（各ノートも合わせて解放されます）
+ */
+void
+free_todo_lookups (
+    Vec_TodoLookup_t _lookups);
+
+/** \brief
+ *  Rust側で確保したTodoのVecを解放します
+ *
+ *  # 引数
+ *
+ *  * `_todos` - 解放するTodoのVec（各Todoのノートも合わせて解放されます）
+ */
+void
+free_todo_vec (
+    Vec_Todo_t _todos);
+
+/** \brief
+ *  すべてのTodoをコピーして取得します
+ *
+ *  1回の呼び出しでリスト全体をコピーするため、`get_todo_id_at` などを
+ *  件数分呼び出すよりもFFIの呼び出し回数を抑えられます。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  すべてのTodoのコピー
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, free_todo_vec, get_all_todos};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  let todos = get_all_todos(&app);
+ *  assert_eq!(todos.len(), 1);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+get_all_todos (
+    App_t const * app);
+
+/** \brief
+ *  記録したFFI関数の呼び出し回数を取得します
+ *
+ *  # 戻り値
+ *
+ *  一度以上呼び出されたFFI関数の名前と回数の一覧（名前順）。
+ *  返されたVecは `free_call_counts` で解放する必要があります。
+ */
+Vec_CallCount_t
+get_call_counts (void);
+
+/** \brief
+ *  アプリケーションの現在のリビジョンを取得します
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  現在のリビジョン（一度も進めていない場合は0）
+ */
+uint64_t
+get_revision (
+    App_t const * app);
+
+/** \brief
+ *  記録したFFI関数の累積実行時間を取得します
+ *
+ *  # 戻り値
+ *
+ *  計測中に一度以上呼び出されたFFI関数の名前と累積時間の一覧（名前順）。
+ *  返されたVecは `free_timing_stats` で解放する必要があります。
+ */
+Vec_CallTiming_t
+get_timing_stats (void);
+
+/** \brief
+ *  アプリケーション内のTodoの数を取得します
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  アプリケーション内のTodoアイテムの数
+ *
+ *  # 使用例
+ *
+ *  ## Rust
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_count};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  assert_eq!(get_todo_count(&app), 0);
+ *
+ *  // Todoを追加
+ *  let note = CString::new("タスク").unwrap();
+ *  let note_ref = char_p::Ref::from(note.as_ref());
+ *  add_todo(&app, 1, note_ref);
+ *
+ *  assert_eq!(get_todo_count(&app), 1);
+ *  ```
+ *
+ *  ## Go
+ *
+ *  ```go
+ *  import (
+ *  "example.com/todo"
+ *  "fmt"
+ *  )
+ *
+ *  func main() {
+ *  app := todo.AppNew()
+ *  defer todo.AppFree(app)
+ *
+ *  todo.AddTodo(app, 1, "重要なタスク")
+ *  count := todo.GetTodoCount(app)
+ *  fmt.Printf("Todo数: %d\n", count)
+ *  }
+ *  ```
+ */
+size_t
+get_todo_count (
+    App_t const * app);
+
+/** \brief
+ *  指定インデックスのTodoのIDを取得します
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `index` - 取得するTodoのインデックス（0から始まる）
+ *
+ *  # 戻り値
+ *
+ *  成功した場合はTodoのID、インデックスが範囲外の場合は-1を返します
+ *
+ *  # 使用例
+ *
+ *  ## Rust
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_id_at};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *
+ *  // インデックスが範囲外の場合は-1を返す
+ *  assert_eq!(get_todo_id_at(&app, 0), -1);
+ *
+ *  // Todoを追加
+ *  let note = CString::new("タスク").unwrap();
+ *  let note_ref = char_p::Ref::from(note.as_ref());
+ *  add_todo(&app, 42, note_ref);
+ *
+ *  // 追加したTodoのIDを取得
+ *  assert_eq!(get_todo_id_at(&app, 0), 42);
+ *  ```
+ *
+ *  ## Go
+ *
+ *  ```go
+ *  import (
+ *  "example.com/todo"
+ *  "fmt"
+ *  )
+ *
+ *  func main() {
+ *  app := todo.AppNew()
+ *  defer todo.AppFree(app)
+ *
+ *  todo.AddTodo(app, 42, "重要なタスク")
+ *  id := todo.GetTodoIdAt(app, 0)
+ *  fmt.Printf("最初のTodoのID: %d\n", id)
+ *  }
+ *  ```
+ */
+int32_t
+get_todo_id_at (
+    App_t const * app,
+    size_t index);
+
+/** \brief
+ *  指定インデックスのTodoのノート（内容）を取得します
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `index` - 取得するTodoのインデックス（0から始まる）
+ *
+ *  # 戻り値
+ *
+ *  成功した場合はTodoのノート、インデックスが範囲外の場合は空文字列を返します
+ *
+ *  # 使用例
+ *
+ *  ## Rust
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_note_at};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *
+ *  // インデックスが範囲外の場合は空文字列を返す
+ *  let empty = get_todo_note_at(&app, 0);
+ *  assert_eq!(empty.to_str(), "");
+ *
+ *  // Todoを追加
+ *  let note = CString::new("重要なタスク").unwrap();
+ *  let note_ref = char_p::Ref::from(note.as_ref());
+ *  add_todo(&app, 1, note_ref);
+ *
+ *  // 追加したTodoのノートを取得
+ *  let retrieved = get_todo_note_at(&app, 0);
+ *  assert_eq!(retrieved.to_str(), "重要なタスク");
+ *  ```
+ *
+ *  ## Go
+ *
+ *  ```go
+ *  import (
+ *  "example.com/todo"
+ *  "fmt"
+ *  )
+ *
+ *  func main() {
+ *  app := todo.AppNew()
+ *  defer todo.AppFree(app)
+ *
+ *  todo.AddTodo(app, 1, "買い物リスト")
+ *  note := todo.GetTodoNoteAt(app, 0)
+ *  fmt.Printf("Todo内容: %s\n", note)
+ *  }
+ *  ```
+ */
+char *
+get_todo_note_at (
+    App_t const * app,
+    size_t index);
+
+/** \brief
+ *  指定インデックスのTodoのノートを、コピーせずにバイト列として参照します
+ *
+ *  # 注意
+ *
+ *  返されるポインタはアプリケーション内部のノートを直接指しています。
+ *  対象のTodoのノートを変更する操作、Todoを追加・削除・並べ替える操作、
+ *  アプリケーションの解放のいずれかを行うと無効になります。
+ *  参照先のメモリを書き換えたり解放したりしてはいけません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `index` - 参照するTodoのインデックス（0から始まる）
+ *
+ *  # 戻り値
+ *
+ *  ノートのバイト列（NUL終端を含まない長さ）、インデックスが範囲外の場合は空のスライスを返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_note_bytes_at};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert_eq!(get_todo_note_bytes_at(&app, 0).as_slice(), "タスク".as_bytes());
+ *  assert!(get_todo_note_bytes_at(&app, 1).is_empty());
+ *  ```
+ */
+slice_ref_uint8_t
+get_todo_note_bytes_at (
+    App_t const * app,
+    size_t index);
+
+/** \brief
+ *  指定インデックスのTodoのノートを、先頭から指定文字数までに切り詰めて取得します
+ *
+ *  保存されているノートは変更せず、切り詰めたコピーを返します。
+ *  文字数はUnicodeのスカラー値単位で数えるため、マルチバイト文字の途中で切れることはありません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `index` - 取得するTodoのインデックス（0から始まる）
+ *  * `max_chars` - 取得する最大文字数
+ *
+ *  # 戻り値
+ *
+ *  切り詰めたノート、インデックスが範囲外の場合は空文字列を返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_note_truncated_at};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("牛乳を買う").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert_eq!(get_todo_note_truncated_at(&app, 0, 2).to_str(), "牛乳");
+ *  assert_eq!(get_todo_note_truncated_at(&app, 0, 10).to_str(), "牛乳を買う");
+ *  ```
+ */
+char *
+get_todo_note_truncated_at (
+    App_t const * app,
+    size_t index,
+    size_t max_chars);
+
+/** \brief
+ *  複数のIDのTodoをまとめて取得します
+ *
+ *  結果は `ids` と同じ順序・同じ件数で返され、見つからなかったIDは `note` がNULLになります。
+ *  同じIDのTodoが複数ある場合は、先頭に近いものを返します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `ids` - 取得するTodoのIDの配列
+ *
+ *  # 戻り値
+ *
+ *  `ids` の各要素に対応する検索結果。
+ *  返されたVecは `free_todo_lookups` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, free_todo_lookups, get_todos_by_ids};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  let ids = [2, 1];
+ *  let lookups = get_todos_by_ids(&app, c_slice::Ref::from(&ids[..]));
+ *  assert!(lookups[0].note.is_none());
+ *  assert_eq!(lookups[1].note.as_ref().unwrap().to_str(), "タスク");
+ *  free_todo_lookups(lookups);
+ *  ```
+ */
+Vec_TodoLookup_t
+get_todos_by_ids (
+    App_t const * app,
+    slice_ref_int32_t ids);
+
+/** \brief
+ *  指定範囲のTodoをコピーして取得します
+ *
+ *  `offset` から最大 `limit` 件のTodoを、ノートも含めて新しく確保したVecにコピーします。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `offset` - コピーを開始するインデックス（0から始まる）
+ *  * `limit` - コピーする最大件数
+ *
+ *  # 戻り値
+ *
+ *  コピーしたTodoのVec（範囲外の場合は空）
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, free_todo_vec, get_todos_range};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for id in 1..=3 {
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let todos = get_todos_range(&app, 1, 10);
+ *  assert_eq!(todos.len(), 2);
+ *  assert_eq!(todos[0].id, 2);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+get_todos_range (
+    App_t const * app,
+    size_t offset,
+    size_t limit);
+
+/** \brief
+ *  IDが指定した範囲に含まれるTodoをコピーして取得します
+ *
+ *  `low` 以上 `high` 以下のIDを持つTodoを、元の順序のまま返します。
+ *  `low` が `high` より大きい場合は空のVecを返します。
+ *  リストがIDの昇順に並んでいるとは限らないため、全体を走査します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `low` - IDの下限（この値を含む）
+ *  * `high` - IDの上限（この値を含む）
+ *
+ *  # 戻り値
+ *
+ *  条件に一致したTodoのコピー。
+ *  返されたVecは `free_todo_vec` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, free_todo_vec, get_todos_with_id_between};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  for id in [5, 1, 3] {
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let todos = get_todos_with_id_between(&app, 1, 3);
+ *  assert_eq!(todos.len(), 2);
+ *  free_todo_vec(todos);
+ *  ```
+ */
+Vec_Todo_t
+get_todos_with_id_between (
+    App_t const * app,
+    int32_t low,
+    int32_t high);
+
+/** \brief
+ *  JSONからTodoリストを読み込み、進捗をコールバックで通知します
+ *
+ *  `todos_to_json` が書き出す `{"schema_version":..,"todos":[..]}` 形式のJSONを読み込みます。
+ *  `load_todos_from_json` と同様に、スキーマバージョンが `current_schema_version` と
+ *  異なる場合は読み込みません。古い形式のJSONは `migrate_todos_json` で変換してから渡します。
+ *
+ *  最初にTodoを確保せずに全体の件数を数え、続く解析ではTodoを1件読むたびに変換しながら
+ *  全体の約1%ごとに `on_progress` を呼び出します。進捗は解析と同時に進むため、
+ *  入力全体の解析が終わるのを待たずに通知されます。成功した場合は最後に必ず
+ *  `done == total` で呼び出します（Todoが0件の場合も `0, 0` で1回呼び出します）。
+ *  途中の要素で解析または変換に失敗した場合は、それまでの進捗を通知した後で失敗を返します。
+ *  読み込みに失敗した場合、Todoリストは変更しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `json` - JSON文字列
+ *  * `on_progress` - 進捗を受け取る関数（NULLの場合は通知しない）。
+ *  引数は `handle`、変換済みの件数、全体の件数の順
+ *  * `handle` - `on_progress` の第1引数にそのまま渡される値
+ *
+ *  # 戻り値
+ *
+ *  読み込みの結果を表す `LoadStatus`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, LoadStatus, import_todos_json_with_progress};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let json = CString::new(r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#).unwrap();
+ *
+ *  assert_eq!(
+ *  import_todos_json_with_progress(&app, char_p::Ref::from(json.as_ref()), None, 0),
+ *  LoadStatus::Ok
+ *  );
+ *  assert_eq!(app.read().todos.len(), 1);
+ *  ```
+ */
+LoadStatus_t
+import_todos_json_with_progress (
+    App_t const * app,
+    char const * json,
+    void (*on_progress)(size_t, size_t, size_t),
+    size_t handle);
+
+/** \brief
+ *  FFI関数の呼び出し回数の計測が有効かどうかを取得します
+ *
+ *  # 戻り値
+ *
+ *  計測が有効な場合は`true`
+ */
+bool
+is_instrumentation_enabled (void);
+
+/** \brief
+ *  スキーマバージョン付きのJSONからTodoリストを読み込みます
+ *
+ *  `todos_to_json` が書き出す形式を読み込み、現在のTodoリストを置き換えます。
+ *  `schema_version` が現在のバージョンと異なる場合は、中身を解析せずに失敗します。
+ *  失敗した場合、Todoリストは変更しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `json` - スキーマバージョン付きのJSON文字列
+ *
+ *  # 戻り値
+ *
+ *  読み込みの結果を表す `LoadStatus`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, LoadStatus, load_todos_from_json};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let json = CString::new(r#"{"schema_version":99,"todos":[]}"#).unwrap();
+ *
+ *  assert_eq!(
+ *  load_todos_from_json(&app, char_p::Ref::from(json.as_ref())),
+ *  LoadStatus::UnsupportedSchema
+ *  );
+ *  ```
+ */
+LoadStatus_t
+load_todos_from_json (
+    App_t const * app,
+    char const * json);
+
+/** \brief
+ *  JSON Lines形式の文字列からTodoリストを読み込みます
+ *
+ *  1行に1件ずつ `{"id":..,"note":..}` 形式のオブジェクトを読み込み、現在のTodoリストを置き換えます。
+ *  空行（末尾の改行を含む）は無視します。いずれかの行の解析に失敗した場合、Todoリストは変更しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `jsonl` - JSON Lines形式の文字列
+ *
+ *  # 戻り値
+ *
+ *  読み込みに成功した場合は`true`、失敗した場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, load_todos_from_jsonl};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let jsonl = CString::new("{\"id\":1,\"note\":\"タスク\"}\n").unwrap();
+ *
+ *  assert!(load_todos_from_jsonl(&app, char_p::Ref::from(jsonl.as_ref())));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "タスク");
+ *  ```
+ */
+bool
+load_todos_from_jsonl (
+    App_t const * app,
+    char const * jsonl);
+
+/** \brief
+ *  MessagePack形式のバイト列からTodoリストを読み込みます
+ *
+ *  `todos_to_msgpack` が書き出す形式（`schema_version` と `todos` を持つマップ）を読み込み、
+ *  現在のTodoリストを置き換えます。`load_todos_from_json` と同様に、スキーマバージョンが
+ *  `current_schema_version` と異なる場合は読み込みません。
+ *  読み込みに失敗した場合、Todoリストは変更しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `data` - MessagePack形式のバイト列
+ *
+ *  # 戻り値
+ *
+ *  読み込みの結果を表す `LoadStatus`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, LoadStatus, add_todo, load_todos_from_msgpack, todos_to_msgpack};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  let bytes = todos_to_msgpack(&app);
+ *
+ *  let restored = App::default();
+ *  assert_eq!(
+ *  load_todos_from_msgpack(&restored, c_slice::Ref::from(&bytes[..])),
+ *  LoadStatus::Ok
+ *  );
+ *  assert_eq!(restored.read().todos[0].note.to_str(), "タスク");
+ *  ```
+ */
+LoadStatus_t
+load_todos_from_msgpack (
+    App_t const * app,
+    slice_ref_uint8_t data);
+
+/** \brief
+ *  古い形式のJSONを現在のスキーマバージョンの形式に変換します
+ *
+ *  次の形式を読み込み、`todos_to_json` と同じ `{"schema_version":..,"todos":[..]}` 形式で返します。
+ *
+ *  * スキーマバージョン導入前の形式（`[{"id":..,"note":..}, ..]` のJSON配列）
+ *  * 現在のスキーマバージョンの形式（内容はそのまま）
+ *
+ *  # 引数
+ *
+ *  * `json` - 変換するJSON文字列
+ *
+ *  # 戻り値
+ *
+ *  現在の形式に変換したJSON文字列。
+ *  形式が不正な場合や、現在より新しいスキーマバージョンの場合はNULLを返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::migrate_todos_json;
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let legacy = CString::new(r#"[{"id":1,"note":"タスク"}]"#).unwrap();
+ *  let migrated = migrate_todos_json(char_p::Ref::from(legacy.as_ref())).unwrap();
+ *  assert_eq!(
+ *  migrated.to_str(),
+ *  r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#
+ *  );
+ *  ```
+ */
+char *
+migrate_todos_json (
+    char const * json);
+
+/** \brief
+ *  ノートの文字列サイズに関する統計を取得します
+ *
+ *  件数、合計、最小、最大、平均を1回の走査でまとめて計算します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  ノートのサイズ統計（ノートがない場合はすべて0）
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, note_alloc_stats};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for note in ["a", "abc"] {
+ *  let note = CString::new(note).unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let stats = note_alloc_stats(&app);
+ *  assert_eq!(stats.count, 2);
+ *  assert_eq!(stats.total_bytes, 4);
+ *  assert_eq!(stats.min_bytes, 1);
+ *  assert_eq!(stats.max_bytes, 3);
+ *  assert_eq!(stats.average_bytes, 2.0);
+ *  ```
+ */
+NoteAllocStats_t
+note_alloc_stats (
+    App_t const * app);
+
+/** \brief
+ *  現在のハッシュ値が一致する場合に限り、Todoリスト全体を置き換えます
+ *
+ *  読み取り時点の `content_hash` を `expected` として渡すことで、
+ *  その後に別の更新が入っていた場合は置き換えを行わない楽観的な更新ができます。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `expected` - 置き換え前のリストに期待するハッシュ値
+ *  * `todos` - 新しいTodoリスト（文字列はコピーして保持されます）
+ *
+ *  # 戻り値
+ *
+ *  置き換えた場合は`true`、ハッシュ値が一致せず何もしなかった場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, TodoRef, content_hash, get_todo_count, replace_all_if_hash};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("新しいタスク").unwrap();
+ *  let todos = [TodoRef { id: 1, note: char_p::Ref::from(note.as_ref()) }];
+ *
+ *  let expected = content_hash(&app);
+ *  assert!(replace_all_if_hash(&app, expected, c_slice::Ref::from(&todos[..])));
+ *  assert_eq!(get_todo_count(&app), 1);
+ *
+ *  // 古いハッシュ値では置き換えられない
+ *  assert!(!replace_all_if_hash(&app, expected, c_slice::Ref::from(&todos[..])));
+ *  ```
+ */
+bool
+replace_all_if_hash (
+    App_t const * app,
+    uint64_t expected,
+    slice_ref_TodoRef_t todos);
+
+/** \brief
+ *  記録したFFI関数の呼び出し回数をすべて0に戻します
+ */
+void
+reset_call_counts (void);
+
+/** \brief
+ *  記録したFFI関数の累積実行時間をすべて0に戻します
+ */
+void
+reset_timing_stats (void);
+
+/** \brief
+ *  FFI関数の呼び出し回数の計測を有効または無効にします
+ *
+ *  計測はライブラリ全体で共通です。無効にしてもそれまでの回数は保持されます。
+ *  計測用の関数（この関数や `get_call_counts` など）自体は回数に含まれません。
+ *
+ *  # 引数
+ *
+ *  * `enabled` - 計測を有効にする場合は`true`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{get_call_counts, get_revision, reset_call_counts, set_instrumentation, App};
+ *
+ *  let app = App::default();
+ *  set_instrumentation(true);
+ *  reset_call_counts();
+ *  get_revision(&app);
+ *  set_instrumentation(false);
+ *
+ *  let counts = get_call_counts();
+ *  let revision = counts.iter().find(|c| c.name.to_str() == "get_revision").unwrap();
+ *  assert_eq!(revision.count, 1);
+ *  ```
+ */
+void
+set_instrumentation (
+    bool enabled);
+
+/** \brief
+ *  Todo追加時にノートを検証する関数を登録します
+ *
+ *  登録後は `add_todo` のたびに `validator` が呼び出され、`false` が返された場合は
+ *  Todoを追加しません。`validator` にNULLを渡すと検証関数の登録を解除します。
+ *
+ *  検証の対象になるのは `add_todo`、`try_add_todo`、`add_todos`、`add_templated_todo`、
+ *  `with_todo`、`upsert_todos` で保存されるノートだけです。
+ *  `replace_all_if_hash`、`load_todos_from_json`、`load_todos_from_jsonl`、
+ *  `load_todos_from_msgpack`、`import_todos_json_with_progress`、`apply_todos_patch_json` は
+ *  Todoリストを丸ごと置き換える・差分を適用する操作のため、検証せずにそのまま保存します。
+ *
+ *  `validator` はアプリケーションの排他ロックを保持したまま呼び出されるため、
+ *  同じアプリケーションを操作するFFI関数を中から呼び出してはいけません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `validator` - ノートを検証する関数（NULLで解除）
+ *  * `handle` - `validator` の第1引数にそのまま渡される値
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, set_note_validator};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  unsafe extern "C" fn reject_empty(_handle: usize, note: char_p::Raw) -> bool {
+ *  !note.as_ref().to_str().is_empty()
+ *  }
+ *
+ *  let app = App::default();
+ *  set_note_validator(&app, Some(reject_empty), 0);
+ *
+ *  let empty = CString::new("").unwrap();
+ *  assert!(!add_todo(&app, 1, char_p::Ref::from(empty.as_ref())));
+ *  ```
+ */
+void
+set_note_validator (
+    App_t const * app,
+    bool (*validator)(size_t, char const *),
+    size_t handle);
+
+/** \brief
+ *  Todo追加時にIDの昇順を保つ位置へ挿入するかどうかを設定します
+ *
+ *  有効にすると `add_todo` は末尾に追加する代わりに、二分探索で求めた位置へ挿入します。
+ *  同じIDのTodoがある場合は、その後ろに挿入されます。既存のTodoは並べ替えないため、
+ *  リストが昇順に並んでいる間だけ順序が保たれます。デフォルトは無効です。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `enabled` - ソート挿入を有効にする場合は`true`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, get_todo_id_at, set_sorted_insert};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  set_sorted_insert(&app, true);
+ *
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 3, char_p::Ref::from(note.as_ref()));
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  assert_eq!(get_todo_id_at(&app, 0), 1);
+ *  ```
+ */
+void
+set_sorted_insert (
+    App_t const * app,
+    bool enabled);
+
+/** \brief
+ *  FFI関数の実行時間の計測を有効または無効にします
+ *
+ *  有効にすると、各FFI関数がRust側で費やした時間を関数ごとに累積します。
+ *  計測はライブラリ全体で共通です。無効にしてもそれまでの累積時間は保持されます。
+ *  計測用の関数自体は対象に含まれません。
+ *
+ *  # 引数
+ *
+ *  * `enabled` - 計測を有効にする場合は`true`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{get_timing_stats, get_todo_count, reset_timing_stats, set_timing, App};
+ *
+ *  let app = App::default();
+ *  set_timing(true);
+ *  reset_timing_stats();
+ *  get_todo_count(&app);
+ *  set_timing(false);
+ *
+ *  let stats = get_timing_stats();
+ *  assert!(stats.iter().any(|t| t.name.to_str() == "get_todo_count"));
+ *  ```
+ */
+void
+set_timing (
+    bool enabled);
+
+/** \brief
+ *  Todoリストのコピーとハッシュ値を同時に取得します
+ *
+ *  1回の呼び出しの中で同じ状態からコピーとハッシュ値を求めるため、
+ *  返されたハッシュ値は必ず返されたリストの内容と対応します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  Todoリストのコピーとハッシュ値。`todos` は `free_todo_vec` で解放する必要があります。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, content_hash, free_todo_vec, snapshot_with_hash};
+ *
+ *  let app = App::default();
+ *  let snapshot = snapshot_with_hash(&app);
+ *  assert_eq!(snapshot.hash, content_hash(&app));
+ *  free_todo_vec(snapshot.todos);
+ *  ```
+ */
+TodoSnapshot_t
+snapshot_with_hash (
+    App_t const * app);
+
+/** \brief
+ *  IDの昇順を保つために `id` を挿入すべき位置を取得します
+ *
+ *  `set_sorted_insert` を有効にした `add_todo` が挿入する位置と同じで、
+ *  同じIDのTodoがある場合はその後ろの位置を返します。
+ *  Todoリストは変更しません。
+ *
+ *  # 前提条件
+ *
+ *  Todoリストが既にIDの昇順に並んでいる必要があります。
+ *  並んでいない場合、戻り値は0以上Todoの数以下であること以外は保証されません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `id` - 挿入するTodoのID
+ *
+ *  # 戻り値
+ *
+ *  `id` を挿入すべきインデックス（0以上Todoの数以下）
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, sorted_insert_pos};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  add_todo(&app, 5, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert_eq!(sorted_insert_pos(&app, 3), 1);
+ *  ```
+ */
+size_t
+sorted_insert_pos (
+    App_t const * app,
+    int32_t id);
+
+/** \brief
+ *  Todoを `batch_size` 件ずつ `sink` に渡します
+ *
+ *  読み取りロックを最後まで保持したまま先頭から順にTodoを走査するため、
+ *  途中で他のスレッドがTodoリストを変更しても、`sink` には同じ時点の
+ *  Todoリストが抜けや重複なく渡されます。Todoはコピーされず、`sink` に渡されたスライスは
+ *  その呼び出しの間だけ有効です。`sink` が `false` を返した場合はそこで中断します。
+ *  `sink` はアプリケーションのロックを保持したまま呼び出されるため、
+ *  同じアプリケーションを操作するFFI関数を中から呼び出してはいけません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `batch_size` - 1回の呼び出しで渡す最大件数
+ *  * `sink` - Todoのスライスを受け取る関数。続ける場合は `true` を返す
+ *  * `handle` - `sink` の第1引数にそのまま渡される値
+ *
+ *  # 戻り値
+ *
+ *  最後まで渡し終えた場合は`true`、`sink` が中断した場合、`batch_size` が0の場合、
+ *  `sink` がNULLの場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, Todo, add_todo, stream_todo_batches};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  unsafe extern "C" fn count(handle: usize, batch: c_slice::Ref<'_, Todo>) -> bool {
+ *  let total = unsafe { &mut *(handle as *mut usize) };
+ *  *total += batch.len();
+ *  true
+ *  }
+ *
+ *  let app = App::default();
+ *  for id in 1..=5 {
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let mut total = 0usize;
+ *  assert!(stream_todo_batches(&app, 2, Some(count), &mut total as *mut usize as usize));
+ *  assert_eq!(total, 5);
+ *  ```
+ */
+bool
+stream_todo_batches (
+    App_t const * app,
+    size_t batch_size,
+    bool (*sink)(size_t, slice_ref_Todo_t),
+    size_t handle);
+
+/** \brief
+ *  2つのアプリケーションのTodoリストを入れ替えます
+ *
+ *  Vecのポインタを交換するだけなので、ノートの再確保は発生しません。
+ *  リビジョンや検証関数などTodoリスト以外の状態はそれぞれのアプリケーションに残ります。
+ *
+ *  # 引数
+ *
+ *  * `app` - 入れ替え対象のアプリケーションインスタンスへの参照
+ *  * `other` - もう一方のアプリケーションインスタンスへの参照（`app` と同一の場合は何もしません）
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, swap_app_contents};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let other = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  swap_app_contents(&app, &other);
+ *  assert_eq!(app.read().todos.len(), 0);
+ *  assert_eq!(other.read().todos.len(), 1);
+ *  ```
+ */
+void
+swap_app_contents (
+    App_t const * app,
+    App_t const * other);
+
+/** \brief
+ *  `with_todo` のコールバックが書き戻すノートを設定します
+ *
+ *  ノートはコピーして保持されるため、呼び出し後に `note` を解放しても構いません。
+ *  複数回呼び出した場合は最後に設定したノートが使われます。
+ *
+ *  # 引数
+ *
+ *  * `edit` - コールバックに渡された書き戻し先への参照
+ *  * `note` - 書き戻すノート
+ */
+void
+todo_edit_set_note (
+    TodoEdit_t * edit,
+    char const * note);
+
+/** \brief
+ *  指定インデックスのTodoの内容からハッシュ値を計算します
+ *
+ *  `content_hash` と同じ計算方式で1件のTodoだけを対象にするため、
+ *  同期のたびに比較すれば、どのTodoが変更されたかを検出できます。
+ *  他のTodoの変更はハッシュ値に影響しません。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `index` - 対象とするTodoのインデックス（0から始まる）
+ *
+ *  # 戻り値
+ *
+ *  Todoのハッシュ値、インデックスが範囲外の場合は0を返します
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, todo_hash_at};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *  let before = todo_hash_at(&app, 0);
+ *
+ *  add_todo(&app, 2, char_p::Ref::from(note.as_ref()));
+ *  assert_eq!(todo_hash_at(&app, 0), before);
+ *  ```
+ */
+uint64_t
+todo_hash_at (
+    App_t const * app,
+    size_t index);
+
+/** \brief
+ *  指定IDのTodoだけをJSON文字列として取得します
  *
  *  # 引数
  *
  *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `id` - シリアライズするTodoの識別子
  *
  *  # 戻り値
  *
- *  アプリケーション内のTodoアイテムの数
+ *  `{"id":..,"note":..}` 形式のJSON文字列。指定IDのTodoが存在しない場合はNULLを返します。
  *
  *  # 使用例
  *
- *  ## Rust
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, todo_json_by_id};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("牛乳を買う").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  let json = todo_json_by_id(&app, 1).unwrap();
+ *  assert_eq!(json.to_str(), r#"{"id":1,"note":"牛乳を買う"}"#);
+ *  assert!(todo_json_by_id(&app, 2).is_none());
+ *  ```
+ */
+char *
+todo_json_by_id (
+    App_t const * app,
+    int32_t id);
+
+/** \brief
+ *  2つのアプリケーションのTodoリストの差分をJSONのパッチとして取得します
+ *
+ *  IDをキーに `base` と `other` を比較し、`{"removed":[..],"changed":[..],"added":[..]}` 形式で返します。
+ *
+ *  * `removed` - `other` にないIDの配列（`base` の順）
+ *  * `changed` - 両方にあり、ノートが異なるTodo（`other` のノート）
+ *  * `added` - `base` にないTodo（`other` の順）
+ *
+ *  同じIDのTodoが複数ある場合は、それぞれ先頭のものだけを比較します。
+ *  `other` が `base` の並び順を保ち、新しいTodoを末尾に追加したものであれば、
+ *  `base` にパッチを適用した結果は `other` と同じ内容・並び順になります。
+ *
+ *  # 引数
+ *
+ *  * `base` - 比較元のTodoアプリケーションインスタンスへの参照
+ *  * `other` - 比較先のTodoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  パッチのJSON文字列。シリアライズに失敗した場合はNULLを返します。
+ *
+ *  # 使用例
  *
  *  ```rust
- *  use safer_ffi_example::{App, add_todo, get_todo_count};
+ *  use safer_ffi_example::{App, add_todo, todos_diff_patch_json};
  *  use safer_ffi::prelude::*;
  *  use std::ffi::CString;
  *
- *  let mut app = App::default();
- *  assert_eq!(get_todo_count(&app), 0);
+ *  let base = App::default();
+ *  let other = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&base, 1, char_p::Ref::from(note.as_ref()));
+ *  add_todo(&other, 2, char_p::Ref::from(note.as_ref()));
+ *
+ *  let patch = todos_diff_patch_json(&base, &other).unwrap();
+ *  assert_eq!(
+ *  patch.to_str(),
+ *  r#"{"removed":[1],"changed":[],"added":[{"id":2,"note":"タスク"}]}"#
+ *  );
+ *  ```
+ */
+char *
+todos_diff_patch_json (
+    App_t const * base,
+    App_t const * other);
+
+/** \brief
+ *  指定範囲のTodoをJSON文字列として取得します
  *
- *  // Todoを追加
+ *  リスト全体ではなく `offset` から最大 `limit` 件だけをシリアライズし、
+ *  全件数を `total` フィールドに含めたオブジェクトを返します。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `offset` - 取得を開始するインデックス（0から始まる）
+ *  * `limit` - 取得する最大件数
+ *
+ *  # 戻り値
+ *
+ *  `{"total":..,"offset":..,"limit":..,"todos":[..]}` 形式のJSON文字列。
+ *  シリアライズに失敗した場合はNULLを返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, todos_page_json};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for id in 1..=3 {
+ *  let note = CString::new(format!("タスク{id}")).unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+ *  }
+ *
+ *  let json = todos_page_json(&app, 1, 1).unwrap();
+ *  assert_eq!(
+ *  json.to_str(),
+ *  r#"{"total":3,"offset":1,"limit":1,"todos":[{"id":2,"note":"タスク2"}]}"#
+ *  );
+ *  ```
+ */
+char *
+todos_page_json (
+    App_t const * app,
+    size_t offset,
+    size_t limit);
+
+/** \brief
+ *  すべてのTodoをスキーマバージョン付きのJSONにシリアライズします
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *
+ *  # 戻り値
+ *
+ *  `{"schema_version":..,"todos":[..]}` 形式のJSON文字列。
+ *  シリアライズに失敗した場合はNULLを返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, todos_to_json};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
  *  let note = CString::new("タスク").unwrap();
- *  let note_ref = char_p::Ref::from(note.as_ref());
- *  add_todo(&mut app, 1, note_ref);
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
  *
- *  assert_eq!(get_todo_count(&app), 1);
+ *  let json = todos_to_json(&app).unwrap();
+ *  assert_eq!(
+ *  json.to_str(),
+ *  r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#
+ *  );
  *  ```
+ */
+char *
+todos_to_json (
+    App_t const * app);
+
+/** \brief
+ *  すべてのTodoを1行に1件ずつのJSON（JSON Lines形式）として取得します
  *
- *  ## Go
+ *  各行は `{"id":..,"note":..}` 形式のオブジェクトで、すべての行が改行で終わります。
+ *  配列形式と異なり、行単位で追記や逐次的な読み込みができます。
  *
- *  ```go
- *  import (
- *  "example.com/todo"
- *  "fmt"
- *  )
+ *  # 引数
  *
- *  func main() {
- *  app := todo.AppNew()
- *  defer todo.AppFree(app)
+ *  * `app` - Todoアプリケーションインスタンスへの参照
  *
- *  todo.AddTodo(app, 1, "重要なタスク")
- *  count := todo.GetTodoCount(app)
- *  fmt.Printf("Todo数: %d\n", count)
+ *  # 戻り値
+ *
+ *  JSON Lines形式の文字列（Todoがない場合は空文字列）。
+ *  シリアライズに失敗した場合はNULLを返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, todos_to_jsonl};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  for id in 1..=2 {
+ *  let note = CString::new(format!("タスク{id}")).unwrap();
+ *  add_todo(&app, id, char_p::Ref::from(note.as_ref()));
  *  }
+ *
+ *  let jsonl = todos_to_jsonl(&app).unwrap();
+ *  assert_eq!(
+ *  jsonl.to_str(),
+ *  "{\"id\":1,\"note\":\"タスク1\"}\n{\"id\":2,\"note\":\"タスク2\"}\n"
+ *  );
  *  ```
  */
-size_t
-get_todo_count (
+char *
+todos_to_jsonl (
     App_t const * app);
 
 /** \brief
- *  指定インデックスのTodoのIDを取得します
+ *  すべてのTodoをMessagePack形式にシリアライズします
+ *
+ *  `todos_to_json` と同じく `{"schema_version":..,"todos":[..]}` 形式のマップとして、
+ *  フィールド名付きで書き出します。各Todoは `{"id":..,"note":..}` 形式のマップです。
  *
  *  # 引数
  *
  *  * `app` - Todoアプリケーションインスタンスへの参照
- *  * `index` - 取得するTodoのインデックス（0から始まる）
  *
  *  # 戻り値
  *
- *  成功した場合はTodoのID、インデックスが範囲外の場合は-1を返します
+ *  MessagePack形式のバイト列。Todoがない場合もスキーマバージョンを含むため、
+ *  シリアライズに失敗した場合のみ空のVecを返します。
+ *  返されたVecは `free_byte_vec` で解放する必要があります。
  *
  *  # 使用例
  *
- *  ## Rust
- *
  *  ```rust
- *  use safer_ffi_example::{App, add_todo, get_todo_id_at};
+ *  use safer_ffi_example::{App, add_todo, free_byte_vec, todos_to_msgpack};
  *  use safer_ffi::prelude::*;
  *  use std::ffi::CString;
  *
- *  let mut app = App::default();
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
  *
- *  // インデックスが範囲外の場合は-1を返す
- *  assert_eq!(get_todo_id_at(&app, 0), -1);
+ *  let bytes = todos_to_msgpack(&app);
+ *  // 要素数2のマップ
+ *  assert_eq!(bytes[0], 0x82);
+ *  free_byte_vec(bytes);
+ *  ```
+ */
+Vec_uint8_t
+todos_to_msgpack (
+    App_t const * app);
+
+/** \brief
+ *  指定IDのTodoのノートから前後の空白を取り除きます
  *
- *  // Todoを追加
- *  let note = CString::new("タスク").unwrap();
- *  let note_ref = char_p::Ref::from(note.as_ref());
- *  add_todo(&mut app, 42, note_ref);
+ *  同じIDのTodoが複数ある場合は、先頭に近いものだけが対象になります。
+ *  空白を取り除いたノートは新しく確保した文字列に置き換えられます。
  *
- *  // 追加したTodoのIDを取得
- *  assert_eq!(get_todo_id_at(&app, 0), 42);
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `id` - 対象とするTodoの識別子
+ *
+ *  # 戻り値
+ *
+ *  対象のTodoが見つかった場合は`true`、見つからなかった場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, trim_todo_note};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("  牛乳を買う\t").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert!(trim_todo_note(&app, 1));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "牛乳を買う");
+ *  assert!(!trim_todo_note(&app, 2));
  *  ```
+ */
+bool
+trim_todo_note (
+    App_t const * app,
+    int32_t id);
+
+/** \brief
+ *  Todoをアプリケーションに追加し、追加できなかった理由を返します
  *
- *  ## Go
+ *  `add_todo` と同じ処理を行いますが、結果を `bool` の代わりに `AddStatus` で返すため、
+ *  呼び出し側は検証関数による拒否を他の失敗と区別できます。
  *
- *  ```go
- *  import (
- *  "example.com/todo"
- *  "fmt"
- *  )
+ *  # 引数
  *
- *  func main() {
- *  app := todo.AppNew()
- *  defer todo.AppFree(app)
+ *  * `app` - Todoを追加するアプリケーションインスタンスへの参照
+ *  * `id` - 追加するTodoの一意識別子
+ *  * `note` - Todoの内容を表す文字列（FFI互換のchar_p::Ref型）
  *
- *  todo.AddTodo(app, 42, "重要なタスク")
- *  id := todo.GetTodoIdAt(app, 0)
- *  fmt.Printf("最初のTodoのID: %d\n", id)
+ *  # 戻り値
+ *
+ *  追加の結果を表す `AddStatus`
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{AddStatus, App, set_note_validator, try_add_todo};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  unsafe extern "C" fn reject_empty(_handle: usize, note: char_p::Raw) -> bool {
+ *  !note.as_ref().to_str().is_empty()
  *  }
+ *
+ *  let app = App::default();
+ *  set_note_validator(&app, Some(reject_empty), 0);
+ *
+ *  let empty = CString::new("").unwrap();
+ *  assert_eq!(
+ *  try_add_todo(&app, 1, char_p::Ref::from(empty.as_ref())),
+ *  AddStatus::ValidationFailed
+ *  );
  *  ```
  */
-int32_t
-get_todo_id_at (
+AddStatus_t
+try_add_todo (
     App_t const * app,
-    size_t index);
+    int32_t id,
+    char const * note);
 
 /** \brief
- *  指定インデックスのTodoのノート（内容）を取得します
+ *  IDをキーにTodoをまとめて追加または更新します
+ *
+ *  既に同じIDのTodoがある場合はそのノートを更新し（同じIDが複数ある場合は先頭のもの）、
+ *  ない場合は `add_todo` と同じ位置（ソート挿入が有効な場合はIDの昇順を保つ位置、
+ *  無効な場合は末尾）に追加します。`todos` 内に同じIDが複数ある場合は、後のものが前のものを更新します。
+ *  更新・追加のどちらの場合も、検証関数が拒否したノートのTodoは反映せず、件数にも含めません。
  *
  *  # 引数
  *
  *  * `app` - Todoアプリケーションインスタンスへの参照
- *  * `index` - 取得するTodoのインデックス（0から始まる）
+ *  * `todos` - 追加または更新するTodoの一覧（文字列はコピーして保持されます）
  *
  *  # 戻り値
  *
- *  成功した場合はTodoのノート、インデックスが範囲外の場合は空文字列を返します
+ *  追加した件数と更新した件数
  *
  *  # 使用例
  *
- *  ## Rust
- *
  *  ```rust
- *  use safer_ffi_example::{App, add_todo, get_todo_note_at};
+ *  use safer_ffi_example::{App, TodoRef, add_todo, upsert_todos};
  *  use safer_ffi::prelude::*;
  *  use std::ffi::CString;
  *
- *  let mut app = App::default();
+ *  let app = App::default();
+ *  let old = CString::new("古いノート").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(old.as_ref()));
  *
- *  // インデックスが範囲外の場合は空文字列を返す
- *  let empty = get_todo_note_at(&app, 0);
- *  assert_eq!(empty.to_str(), "");
+ *  let new = CString::new("新しいノート").unwrap();
+ *  let note = char_p::Ref::from(new.as_ref());
+ *  let todos = [TodoRef { id: 1, note }, TodoRef { id: 2, note }];
  *
- *  // Todoを追加
- *  let note = CString::new("重要なタスク").unwrap();
- *  let note_ref = char_p::Ref::from(note.as_ref());
- *  add_todo(&mut app, 1, note_ref);
+ *  let counts = upsert_todos(&app, c_slice::Ref::from(&todos[..]));
+ *  assert_eq!((counts.inserted, counts.updated), (1, 1));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "新しいノート");
+ *  ```
+ */
+UpsertCounts_t
+upsert_todos (
+    App_t const * app,
+    slice_ref_TodoRef_t todos);
+
+/** \brief
+ *  JSONのパッチが現在のTodoリストに適用できるかを確認します
  *
- *  // 追加したTodoのノートを取得
- *  let retrieved = get_todo_note_at(&app, 0);
- *  assert_eq!(retrieved.to_str(), "重要なタスク");
+ *  `apply_todos_patch_json` と同じ検査を、Todoリストを変更せずに行います。
+ *
+ *  # 引数
+ *
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `patch` - パッチのJSON文字列
+ *
+ *  # 戻り値
+ *
+ *  パッチの形式が正しく、現在の状態に適用できる場合は`true`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, add_todo, validate_todos_patch_json};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  let patch = CString::new(r#"{"removed":[2]}"#).unwrap();
+ *  assert!(!validate_todos_patch_json(&app, char_p::Ref::from(patch.as_ref())));
  *  ```
+ */
+bool
+validate_todos_patch_json (
+    App_t const * app,
+    char const * patch);
+
+/** \brief
+ *  指定IDのTodoを排他ロックを保持したままコールバックに渡し、設定されたノートで書き戻します
  *
- *  ## Go
+ *  検索からコールバックの呼び出し、書き戻しまでを1つのロックの中で行うため、
+ *  同じアプリケーションに対する他の操作が途中で割り込むことはありません。
+ *  コールバックは `todo_edit_set_note` で新しいノートを設定し、書き戻す場合は`true`を返します。
+ *  新しいノートは `add_todo` と同様に検証関数の対象になります。
+ *  同じIDのTodoが複数ある場合は、先頭に近いものだけが対象になります。
  *
- *  ```go
- *  import (
- *  "example.com/todo"
- *  "fmt"
- *  )
+ *  コールバックはロックを保持したまま呼び出されるため、同じアプリケーションを
+ *  操作するFFI関数を中から呼び出してはいけません。
  *
- *  func main() {
- *  app := todo.AppNew()
- *  defer todo.AppFree(app)
+ *  # 引数
  *
- *  todo.AddTodo(app, 1, "買い物リスト")
- *  note := todo.GetTodoNoteAt(app, 0)
- *  fmt.Printf("Todo内容: %s\n", note)
+ *  * `app` - Todoアプリケーションインスタンスへの参照
+ *  * `id` - 対象とするTodoの識別子
+ *  * `updater` - 対象のTodoを受け取り、書き戻すかどうかを返す関数
+ *  * `handle` - `updater` の第1引数にそのまま渡される値
+ *
+ *  # 戻り値
+ *
+ *  書き戻した場合は`true`を返します。指定IDのTodoが存在しない場合、`updater` がNULLの場合、
+ *  `updater` が`false`を返した場合、検証関数がノートを拒否した場合は`false`を返します。
+ *
+ *  # 使用例
+ *
+ *  ```rust
+ *  use safer_ffi_example::{App, Todo, TodoEdit, add_todo, todo_edit_set_note, with_todo};
+ *  use safer_ffi::prelude::*;
+ *  use std::ffi::CString;
+ *
+ *  unsafe extern "C" fn append_mark(_handle: usize, todo: &Todo, edit: &mut TodoEdit) -> bool {
+ *  let note = CString::new(format!("{}!", todo.note.to_str())).unwrap();
+ *  todo_edit_set_note(edit, char_p::Ref::from(note.as_ref()));
+ *  true
  *  }
+ *
+ *  let app = App::default();
+ *  let note = CString::new("タスク").unwrap();
+ *  add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+ *
+ *  assert!(with_todo(&app, 1, Some(append_mark), 0));
+ *  assert_eq!(app.read().todos[0].note.to_str(), "タスク!");
+ *  assert!(!with_todo(&app, 2, Some(append_mark), 0));
  *  ```
  */
-char *
-get_todo_note_at (
+bool
+with_todo (
     App_t const * app,
-    size_t index);
+    int32_t id,
+    bool (*updater)(size_t, Todo_t const *, TodoEdit_t *),
+    size_t handle);
 
 
 #ifdef __cplusplus
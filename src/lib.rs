@@ -1,4 +1,12 @@
 use safer_ffi::prelude::*;
+use serde::de::{self, DeserializeSeed, Deserializer, IgnoredAny, MapAccess, SeqAccess, Visitor};
+use serde::ser::{Serialize, SerializeStruct, Serializer};
+use serde::Deserialize;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fmt;
+use std::sync::atomic::{AtomicBool, AtomicU64, Ordering};
+use std::sync::{Mutex, RwLock, RwLockReadGuard, RwLockWriteGuard};
+use std::time::Instant;
 
 /// Todoアイテムを表す構造体
 ///
@@ -55,13 +63,45 @@ impl Todo {
     }
 }
 
+impl Serialize for Todo {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        // char_p::Boxはserdeに対応していないため、フィールドを手動でシリアライズする
+        let mut state = serializer.serialize_struct("Todo", 2)?;
+        state.serialize_field("id", &self.id)?;
+        state.serialize_field("note", self.note.to_str())?;
+        state.end()
+    }
+}
+
+/// JSONから読み込んだTodoの中間表現
+///
+/// char_p::Boxは直接デシリアライズできないため、一度Stringで受け取ってから変換します。
+#[derive(serde::Deserialize)]
+struct TodoRecord {
+    id: i32,
+    note: String,
+}
+
+impl TryFrom<TodoRecord> for Todo {
+    type Error = std::ffi::NulError;
+
+    /// ノートにNUL文字が含まれる場合はC文字列にできないため失敗します
+    fn try_from(record: TodoRecord) -> Result<Self, Self::Error> {
+        let c_string = std::ffi::CString::new(record.note)?;
+        Ok(Self {
+            id: record.id,
+            note: char_p::Box::from(c_string),
+        })
+    }
+}
+
 /// Todoアプリケーションの状態を管理する構造体
 ///
 /// 複数のTodoアイテムを管理し、FFIを通じてC/Go言語からも利用可能です。
-///
-/// # フィールド
-///
-/// * `todos` - Todo項目のコレクション（FFI互換のrepr_c::Vec型）
+/// C/Go言語からは不透明な型として扱われ、内部の状態には `App::read` と
+/// `App::write` で取得するロックを通してアクセスします。
+/// 読み取りだけを行うFFI関数は共有ロックを、変更を行うFFI関数は排他ロックを取るため、
+/// 同じインスタンスを複数のスレッドから同時に操作できます。
 ///
 /// # 使用例
 ///
@@ -70,29 +110,300 @@ impl Todo {
 /// use safer_ffi::prelude::*;
 ///
 /// // 空のAppインスタンスを作成
-/// let mut app = App::default();
-/// assert_eq!(app.todos.len(), 0);
+/// let app = App::default();
+/// assert_eq!(app.read().todos.len(), 0);
 ///
 /// // CStringを作成してchar_p::Refに変換
 /// let note = std::ffi::CString::new("牛乳を買う").unwrap();
 /// let note_ref = char_p::Ref::from(note.as_ref());
 ///
 /// // Todoを追加
-/// add_todo(&mut app, 1, note_ref);
+/// add_todo(&app, 1, note_ref);
 /// ```
 #[derive_ReprC]
-#[repr(C)]
-#[derive(Debug, Clone)]
+#[repr(opaque)]
+#[derive(Debug, Default)]
 pub struct App {
+    state: RwLock<AppState>,
+    revision: AtomicU64,
+}
+
+impl App {
+    /// 共有ロックを取得して内部の状態を参照します
+    ///
+    /// ロックを保持している間は、同じインスタンスを変更するFFI関数が待たされます。
+    pub fn read(&self) -> RwLockReadGuard<'_, AppState> {
+        self.state.read().unwrap_or_else(|err| err.into_inner())
+    }
+
+    /// 排他ロックを取得して内部の状態を変更します
+    ///
+    /// ロックを保持している間は、同じインスタンスを操作する他のFFI関数がすべて待たされます。
+    pub fn write(&self) -> RwLockWriteGuard<'_, AppState> {
+        self.state.write().unwrap_or_else(|err| err.into_inner())
+    }
+}
+
+/// `App` がロックの内側に保持する状態
+///
+/// # フィールド
+///
+/// * `todos` - Todo項目のコレクション（FFI互換のrepr_c::Vec型）
+/// * `note_validator` - Todo追加時にノートを検証する関数（未設定の場合はNULL）
+/// * `note_validator_handle` - `note_validator` に渡される呼び出し側のハンドル
+/// * `sorted_insert` - `true` の場合、Todo追加時にIDの昇順を保つ位置へ挿入する
+#[derive(Debug, Clone)]
+pub struct AppState {
     pub todos: repr_c::Vec<Todo>,
+    pub note_validator: Option<NoteValidator>,
+    pub note_validator_handle: usize,
+    pub sorted_insert: bool,
 }
 
-impl Default for App {
+impl Default for AppState {
     fn default() -> Self {
         Self {
             todos: Vec::new().into(),
+            note_validator: None,
+            note_validator_handle: 0,
+            sorted_insert: false,
+        }
+    }
+}
+
+/// Todo追加時にノートを検証するコールバック関数の型
+///
+/// 第1引数には登録時に渡したハンドル、第2引数には検証するノートが渡されます。
+/// ノートを受け付ける場合は`true`、拒否する場合は`false`を返します。
+pub type NoteValidator = unsafe extern "C" fn(usize, char_p::Raw) -> bool;
+
+/// FFI経由でTodoをまとめて受け取るための借用版構造体
+///
+/// 文字列は呼び出し側が所有しており、Rust側では必要に応じてコピーして保持します。
+///
+/// # フィールド
+///
+/// * `id` - Todo項目の一意識別子
+/// * `note` - Todo項目の内容を表す文字列（FFI互換のchar_p::Ref型）
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone, Copy)]
+pub struct TodoRef<'a> {
+    pub id: i32,
+    pub note: char_p::Ref<'a>,
+}
+
+impl From<&TodoRef<'_>> for Todo {
+    fn from(todo: &TodoRef<'_>) -> Self {
+        Todo::new(todo.id, todo.note.to_str())
+    }
+}
+
+/// ノートとして確保されている文字列のサイズに関する統計
+///
+/// サイズはいずれもNUL終端を除いたバイト数です。
+///
+/// # フィールド
+///
+/// * `count` - ノートの数
+/// * `total_bytes` - ノートの合計バイト数
+/// * `min_bytes` - 最も短いノートのバイト数（ノートがない場合は0）
+/// * `max_bytes` - 最も長いノートのバイト数（ノートがない場合は0）
+/// * `average_bytes` - ノートの平均バイト数（ノートがない場合は0）
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct NoteAllocStats {
+    pub count: usize,
+    pub total_bytes: usize,
+    pub min_bytes: usize,
+    pub max_bytes: usize,
+    pub average_bytes: f64,
+}
+
+/// Todoリストのコピーと、そのハッシュ値の組
+///
+/// # フィールド
+///
+/// * `todos` - Todoリストのコピー（`free_todo_vec` で解放します）
+/// * `hash` - コピー元のリストから計算した `content_hash` の値
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone)]
+pub struct TodoSnapshot {
+    pub todos: repr_c::Vec<Todo>,
+    pub hash: u64,
+}
+
+/// `upsert_todos` で追加・更新したTodoの件数
+///
+/// # フィールド
+///
+/// * `inserted` - 新しく追加したTodoの件数
+/// * `updated` - 既存のTodoのノートを更新した件数
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct UpsertCounts {
+    pub inserted: usize,
+    pub updated: usize,
+}
+
+/// ノートのテンプレートに埋め込む変数を表す借用版構造体
+///
+/// # フィールド
+///
+/// * `key` - テンプレート中の `{{key}}` に対応する変数名
+/// * `value` - 置換する値
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone, Copy)]
+pub struct TemplateVar<'a> {
+    pub key: char_p::Ref<'a>,
+    pub value: char_p::Ref<'a>,
+}
+
+/// テンプレート中の `{{key}}` を対応する変数の値に置き換えます
+///
+/// 対応する変数がないプレースホルダーと閉じられていない `{{` はそのまま残します。
+/// 置換後の値に含まれる `{{...}}` は再度展開しません。
+fn render_template(template: &str, vars: &[TemplateVar<'_>]) -> String {
+    let mut rendered = String::with_capacity(template.len());
+    let mut rest = template;
+
+    while let Some(start) = rest.find("{{") {
+        rendered.push_str(&rest[..start]);
+        let after_open = &rest[start + 2..];
+
+        let Some(end) = after_open.find("}}") else {
+            rest = &rest[start..];
+            break;
+        };
+
+        let key = &after_open[..end];
+        match vars.iter().find(|var| var.key.to_str() == key) {
+            Some(var) => rendered.push_str(var.value.to_str()),
+            None => rendered.push_str(&rest[start..start + 2 + end + 2]),
+        }
+        rest = &after_open[end + 2..];
+    }
+
+    // 残りの部分（閉じられていない `{{` を含む）をそのまま追加
+    rendered.push_str(rest);
+
+    rendered
+}
+
+/// FFI関数ごとの呼び出し回数
+///
+/// # フィールド
+///
+/// * `name` - FFI関数の名前
+/// * `count` - 計測を有効にしてからの呼び出し回数
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone)]
+pub struct CallCount {
+    pub name: char_p::Box,
+    pub count: u64,
+}
+
+/// 呼び出し回数の計測が有効かどうか
+static INSTRUMENTATION_ENABLED: AtomicBool = AtomicBool::new(false);
+
+/// FFI関数の名前ごとの呼び出し回数
+static CALL_COUNTS: Mutex<BTreeMap<&'static str, u64>> = Mutex::new(BTreeMap::new());
+
+/// FFI関数ごとの累積実行時間
+///
+/// # フィールド
+///
+/// * `name` - FFI関数の名前
+/// * `nanos` - 計測を有効にしてからRust側で費やした時間の合計（ナノ秒）
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone)]
+pub struct CallTiming {
+    pub name: char_p::Box,
+    pub nanos: u64,
+}
+
+/// 実行時間の計測が有効かどうか
+static TIMING_ENABLED: AtomicBool = AtomicBool::new(false);
+
+/// FFI関数の名前ごとの累積実行時間（ナノ秒）
+static CALL_NANOS: Mutex<BTreeMap<&'static str, u64>> = Mutex::new(BTreeMap::new());
+
+/// FFI関数の1回の呼び出しを表すガード
+///
+/// 実行時間の計測が有効な場合、ドロップ時に開始からの経過時間を加算します。
+struct CallGuard {
+    name: &'static str,
+    started: Option<Instant>,
+}
+
+impl Drop for CallGuard {
+    fn drop(&mut self) {
+        let Some(started) = self.started else {
+            return;
+        };
+
+        let elapsed = u64::try_from(started.elapsed().as_nanos()).unwrap_or(u64::MAX);
+        let mut nanos = CALL_NANOS.lock().unwrap_or_else(|err| err.into_inner());
+        let total = nanos.entry(self.name).or_insert(0);
+        *total = total.saturating_add(elapsed);
+    }
+}
+
+/// 計測が有効な場合に、FFI関数の呼び出しを1回記録します
+///
+/// 各FFI関数の先頭で呼び出し、返されたガードを関数の終わりまで保持します。
+/// 計測が無効な場合はロックを取らずに戻ります。
+#[must_use = "ガードをすぐにドロップすると実行時間が計測されません"]
+fn record_call(name: &'static str) -> CallGuard {
+    if INSTRUMENTATION_ENABLED.load(Ordering::Relaxed) {
+        let mut counts = CALL_COUNTS.lock().unwrap_or_else(|err| err.into_inner());
+        *counts.entry(name).or_insert(0) += 1;
+    }
+
+    CallGuard {
+        name,
+        started: TIMING_ENABLED.load(Ordering::Relaxed).then(Instant::now),
+    }
+}
+
+/// 実行ごとに値が変わらないFNV-1a方式のハッシュ計算器
+///
+/// `std::collections::hash_map::DefaultHasher` はバージョン間で結果が変わりうるため、
+/// プロセスをまたいで比較するハッシュにはこちらを使います。
+struct StableHasher(u64);
+
+impl StableHasher {
+    const OFFSET_BASIS: u64 = 0xcbf2_9ce4_8422_2325;
+    const PRIME: u64 = 0x0000_0100_0000_01b3;
+
+    fn new() -> Self {
+        Self(Self::OFFSET_BASIS)
+    }
+
+    fn write(&mut self, bytes: &[u8]) {
+        for byte in bytes {
+            self.0 ^= u64::from(*byte);
+            self.0 = self.0.wrapping_mul(Self::PRIME);
         }
     }
+
+    fn write_todo(&mut self, todo: &Todo) {
+        let note = todo.note.to_str().as_bytes();
+        self.write(&todo.id.to_le_bytes());
+        // 長さを含めることで、ノートの区切り位置が異なるリスト同士の衝突を防ぐ
+        self.write(&(note.len() as u64).to_le_bytes());
+        self.write(note);
+    }
+
+    fn finish(&self) -> u64 {
+        self.0
+    }
 }
 
 /// 新しいAppインスタンスを作成します
@@ -124,6 +435,7 @@ impl Default for App {
 /// ```
 #[ffi_export]
 pub fn app_new() -> repr_c::Box<App> {
+    let _call = record_call("app_new");
     Box::new(App::default()).into()
 }
 
@@ -131,13 +443,14 @@ pub fn app_new() -> repr_c::Box<App> {
 ///
 /// # 引数
 ///
-/// * `app` - Todoを追加するアプリケーションインスタンスへの可変参照
+/// * `app` - Todoを追加するアプリケーションインスタンスへの参照
 /// * `id` - 追加するTodoの一意識別子
 /// * `note` - Todoの内容を表す文字列（FFI互換のchar_p::Ref型）
 ///
 /// # 戻り値
 ///
 /// 追加が成功した場合は`true`、失敗した場合は`false`を返します。
+/// `set_note_validator` で登録した検証関数がノートを拒否した場合も`false`を返します。
 ///
 /// # 使用例
 ///
@@ -148,11 +461,11 @@ pub fn app_new() -> repr_c::Box<App> {
 /// use safer_ffi::prelude::*;
 /// use std::ffi::CString;
 ///
-/// let mut app = App::default();
+/// let app = App::default();
 /// let note = CString::new("重要なタスク").unwrap();
 /// let note_ref = char_p::Ref::from(note.as_ref());
 ///
-/// let success = add_todo(&mut app, 1, note_ref);
+/// let success = add_todo(&app, 1, note_ref);
 /// assert!(success);
 /// ```
 ///
@@ -169,7 +482,78 @@ pub fn app_new() -> repr_c::Box<App> {
 /// }
 /// ```
 #[ffi_export]
-pub fn add_todo(app: &mut App, id: i32, note: char_p::Ref<'_>) -> bool {
+pub fn add_todo(app: &App, id: i32, note: char_p::Ref<'_>) -> bool {
+    let _call = record_call("add_todo");
+    let mut app = app.write();
+    insert_todo(&mut app, id, note)
+}
+
+/// `try_add_todo` の結果
+#[derive_ReprC]
+#[repr(i32)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum AddStatus {
+    /// 追加に成功した
+    Added,
+    /// 登録された検証関数がノートを拒否した
+    ValidationFailed,
+}
+
+/// Todoをアプリケーションに追加し、追加できなかった理由を返します
+///
+/// `add_todo` と同じ処理を行いますが、結果を `bool` の代わりに `AddStatus` で返すため、
+/// 呼び出し側は検証関数による拒否を他の失敗と区別できます。
+///
+/// # 引数
+///
+/// * `app` - Todoを追加するアプリケーションインスタンスへの参照
+/// * `id` - 追加するTodoの一意識別子
+/// * `note` - Todoの内容を表す文字列（FFI互換のchar_p::Ref型）
+///
+/// # 戻り値
+///
+/// 追加の結果を表す `AddStatus`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{AddStatus, App, set_note_validator, try_add_todo};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// unsafe extern "C" fn reject_empty(_handle: usize, note: char_p::Raw) -> bool {
+///     !note.as_ref().to_str().is_empty()
+/// }
+///
+/// let app = App::default();
+/// set_note_validator(&app, Some(reject_empty), 0);
+///
+/// let empty = CString::new("").unwrap();
+/// assert_eq!(
+///     try_add_todo(&app, 1, char_p::Ref::from(empty.as_ref())),
+///     AddStatus::ValidationFailed
+/// );
+/// ```
+#[ffi_export]
+pub fn try_add_todo(app: &App, id: i32, note: char_p::Ref<'_>) -> AddStatus {
+    let _call = record_call("try_add_todo");
+    let mut app = app.write();
+    if insert_todo(&mut app, id, note) {
+        AddStatus::Added
+    } else {
+        AddStatus::ValidationFailed
+    }
+}
+
+/// `add_todo` の本体
+///
+/// 他のFFI関数から呼び出しても呼び出し回数の計測に含まれないよう分離しています。
+fn insert_todo(app: &mut AppState, id: i32, note: char_p::Ref<'_>) -> bool {
+    // 検証関数が登録されている場合は、拒否されたノートを追加しない
+    if !note_accepted(app, note) {
+        return false;
+    }
+
     // 文字列をRustの文字列に変換
     let note_str = note.to_str();
 
@@ -180,8 +564,13 @@ pub fn add_todo(app: &mut App, id: i32, note: char_p::Ref<'_>) -> bool {
     // Note: FFI互換のrepr_c::Vecから標準のVecに変換して操作する必要がある
     let mut native_vec: Vec<Todo> = app.todos.iter().cloned().collect();
 
-    // 値を追加
-    native_vec.push(todo);
+    // 値を追加（ソート挿入が有効な場合は同じIDの後ろになる位置へ挿入）
+    if app.sorted_insert {
+        let index = sorted_insert_index(&native_vec, id);
+        native_vec.insert(index, todo);
+    } else {
+        native_vec.push(todo);
+    }
 
     // 再び repr_c::Vec に変換して設定
     app.todos = native_vec.into();
@@ -189,6 +578,25 @@ pub fn add_todo(app: &mut App, id: i32, note: char_p::Ref<'_>) -> bool {
     true
 }
 
+/// 登録された検証関数でノートを検証します
+///
+/// 検証関数が登録されていない場合は常に`true`を返します。
+fn note_accepted(app: &AppState, note: char_p::Ref<'_>) -> bool {
+    let Some(validator) = app.note_validator else {
+        return true;
+    };
+
+    // SAFETY: 検証関数は呼び出し側が登録したもので、noteはこの呼び出しの間有効
+    unsafe { validator(app.note_validator_handle, note.into()) }
+}
+
+/// IDの昇順に並んだ `todos` に `id` を挿入する位置を二分探索で求めます
+///
+/// 同じIDのTodoがある場合は、その後ろの位置を返します。
+fn sorted_insert_index(todos: &[Todo], id: i32) -> usize {
+    todos.partition_point(|todo| todo.id <= id)
+}
+
 /// アプリケーション内のTodoの数を取得します
 ///
 /// # 引数
@@ -208,13 +616,13 @@ pub fn add_todo(app: &mut App, id: i32, note: char_p::Ref<'_>) -> bool {
 /// use safer_ffi::prelude::*;
 /// use std::ffi::CString;
 ///
-/// let mut app = App::default();
+/// let app = App::default();
 /// assert_eq!(get_todo_count(&app), 0);
 ///
 /// // Todoを追加
 /// let note = CString::new("タスク").unwrap();
 /// let note_ref = char_p::Ref::from(note.as_ref());
-/// add_todo(&mut app, 1, note_ref);
+/// add_todo(&app, 1, note_ref);
 ///
 /// assert_eq!(get_todo_count(&app), 1);
 /// ```
@@ -238,6 +646,8 @@ pub fn add_todo(app: &mut App, id: i32, note: char_p::Ref<'_>) -> bool {
 /// ```
 #[ffi_export]
 pub fn get_todo_count(app: &App) -> usize {
+    let _call = record_call("get_todo_count");
+    let app = app.read();
     app.todos.len()
 }
 
@@ -261,7 +671,7 @@ pub fn get_todo_count(app: &App) -> usize {
 /// use safer_ffi::prelude::*;
 /// use std::ffi::CString;
 ///
-/// let mut app = App::default();
+/// let app = App::default();
 ///
 /// // インデックスが範囲外の場合は-1を返す
 /// assert_eq!(get_todo_id_at(&app, 0), -1);
@@ -269,7 +679,7 @@ pub fn get_todo_count(app: &App) -> usize {
 /// // Todoを追加
 /// let note = CString::new("タスク").unwrap();
 /// let note_ref = char_p::Ref::from(note.as_ref());
-/// add_todo(&mut app, 42, note_ref);
+/// add_todo(&app, 42, note_ref);
 ///
 /// // 追加したTodoのIDを取得
 /// assert_eq!(get_todo_id_at(&app, 0), 42);
@@ -294,6 +704,8 @@ pub fn get_todo_count(app: &App) -> usize {
 /// ```
 #[ffi_export]
 pub fn get_todo_id_at(app: &App, index: usize) -> i32 {
+    let _call = record_call("get_todo_id_at");
+    let app = app.read();
     if index < app.todos.len() {
         app.todos[index].id
     } else {
@@ -321,7 +733,7 @@ pub fn get_todo_id_at(app: &App, index: usize) -> i32 {
 /// use safer_ffi::prelude::*;
 /// use std::ffi::CString;
 ///
-/// let mut app = App::default();
+/// let app = App::default();
 ///
 /// // インデックスが範囲外の場合は空文字列を返す
 /// let empty = get_todo_note_at(&app, 0);
@@ -330,7 +742,7 @@ pub fn get_todo_id_at(app: &App, index: usize) -> i32 {
 /// // Todoを追加
 /// let note = CString::new("重要なタスク").unwrap();
 /// let note_ref = char_p::Ref::from(note.as_ref());
-/// add_todo(&mut app, 1, note_ref);
+/// add_todo(&app, 1, note_ref);
 ///
 /// // 追加したTodoのノートを取得
 /// let retrieved = get_todo_note_at(&app, 0);
@@ -356,6 +768,8 @@ pub fn get_todo_id_at(app: &App, index: usize) -> i32 {
 /// ```
 #[ffi_export]
 pub fn get_todo_note_at(app: &App, index: usize) -> char_p::Box {
+    let _call = record_call("get_todo_note_at");
+    let app = app.read();
     if index < app.todos.len() {
         // 文字列をコピーして返す
         let note_str = app.todos[index].note.to_str();
@@ -366,90 +780,2718 @@ pub fn get_todo_note_at(app: &App, index: usize) -> char_p::Box {
     }
 }
 
-#[ffi_export]
-pub fn free_char_p_box(_boxed: char_p::Box) {
-    // repr_c::Box はドロップ時に自動的にメモリを解放します
-    // この関数内で何もする必要はありません
-    // boxed は関数終了時に自動的にドロップされます
-}
-
-/// アプリケーションのメモリを解放します
+/// アプリケーションのリビジョンを1つ進めます
 ///
-/// この関数を呼び出すことで、アプリケーションが使用していたメモリリソースが
-/// 適切に解放されます。Go言語からの利用時には、defer文を使用して確実に呼び出すことが推奨されます。
+/// リビジョンはTodoの変更とは無関係に、利用者が任意のタイミングで進めるカウンタです。
+/// アトミックにインクリメントするため、複数のスレッドから同時に呼び出しても
+/// 同じ値が二度返されることはありません。
 ///
 /// # 引数
 ///
-/// * `_app` - 解放するアプリケーションインスタンス
+/// * `app` - Todoアプリケーションインスタンスへの参照
 ///
-/// # 注意
+/// # 戻り値
 ///
-/// この関数内では特別な処理は行われず、Rustの所有権システムによって自動的にメモリが解放されます。
-/// repr_c::Box はドロップ時に自動的にメモリを解放します。
+/// インクリメント後のリビジョン
 ///
 /// # 使用例
 ///
-/// ## Go
+/// ```rust
+/// use safer_ffi_example::{App, bump_revision, get_revision};
 ///
-/// ```go
-/// import "example.com/todo"
+/// let app = App::default();
+/// assert_eq!(bump_revision(&app), 1);
+/// assert_eq!(bump_revision(&app), 2);
+/// assert_eq!(get_revision(&app), 2);
+/// ```
+#[ffi_export]
+pub fn bump_revision(app: &App) -> u64 {
+    let _call = record_call("bump_revision");
+    app.revision.fetch_add(1, Ordering::Relaxed).wrapping_add(1)
+}
+
+/// アプリケーションの現在のリビジョンを取得します
 ///
-/// func main() {
-///     app := todo.AppNew()
-///     defer todo.AppFree(app) // 確実にメモリを解放
+/// # 引数
 ///
-///     // アプリの操作...
-/// }
-/// ```
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// 現在のリビジョン（一度も進めていない場合は0）
 #[ffi_export]
-pub fn app_free(_app: repr_c::Box<App>) {
-    // repr_c::Box はドロップ時に自動的にメモリを解放します
-    // この関数内で何もする必要はありません
-    // app は関数終了時に自動的にドロップされます
+pub fn get_revision(app: &App) -> u64 {
+    let _call = record_call("get_revision");
+    app.revision.load(Ordering::Relaxed)
 }
 
-/// FFIヘッダーファイルを生成します
+/// JSONでページ単位に返すTodo一覧の外枠
+#[derive(serde::Serialize)]
+struct TodoPage<'a> {
+    total: usize,
+    offset: usize,
+    limit: usize,
+    todos: &'a [Todo],
+}
+
+/// 指定範囲のTodoをJSON文字列として取得します
 ///
-/// このプロジェクトのRust関数とデータ構造をC/C++/Go等から利用するための
-/// ヘッダーファイルを生成します。ビルド時に`headers`機能が有効な場合のみ利用可能です。
+/// リスト全体ではなく `offset` から最大 `limit` 件だけをシリアライズし、
+/// 全件数を `total` フィールドに含めたオブジェクトを返します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `offset` - 取得を開始するインデックス（0から始まる）
+/// * `limit` - 取得する最大件数
 ///
 /// # 戻り値
 ///
-/// ヘッダーファイルの生成結果を表すResult
+/// `{"total":..,"offset":..,"limit":..,"todos":[..]}` 形式のJSON文字列。
+/// シリアライズに失敗した場合はNULLを返します。
 ///
 /// # 使用例
 ///
-/// ```rust,no_run
-/// #[cfg(feature = "headers")]
-/// fn main() -> std::io::Result<()> {
-///     safer_ffi_example::generate_headers()
-/// }
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todos_page_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
 ///
-/// #[cfg(not(feature = "headers"))]
-/// fn main() {
-///     println!("headers機能が有効ではありません");
+/// let app = App::default();
+/// for id in 1..=3 {
+///     let note = CString::new(format!("タスク{id}")).unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
 /// }
+///
+/// let json = todos_page_json(&app, 1, 1).unwrap();
+/// assert_eq!(
+///     json.to_str(),
+///     r#"{"total":3,"offset":1,"limit":1,"todos":[{"id":2,"note":"タスク2"}]}"#
+/// );
 /// ```
-#[cfg(feature = "headers")]
-pub fn generate_headers() -> ::std::io::Result<()> {
-    ::safer_ffi::headers::builder()
-        .to_file("./go_example/safer_ffi_example.h")?
-        .generate()
-}
+#[ffi_export]
+pub fn todos_page_json(app: &App, offset: usize, limit: usize) -> Option<char_p::Box> {
+    let _call = record_call("todos_page_json");
+    let app = app.read();
+    let start = offset.min(app.todos.len());
+    let end = start.saturating_add(limit).min(app.todos.len());
+    let page = TodoPage {
+        total: app.todos.len(),
+        offset,
+        limit,
+        todos: &app.todos[start..end],
+    };
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-    use std::ffi::CStr;
+    let json = serde_json::to_string(&page).ok()?;
+    json.try_into().ok()
+}
 
-    // テスト用にchar_p::Refを作成するヘルパー関数
-    // CStringとchar_p::Refの両方を返す理由:
-    // 1. char_p::RefはCStringが持つヒープメモリ上の文字列データへのポインタを保持している
-    // 2. CStringがスコープを抜けてdropされると、そのヒープメモリは解放される
-    // 3. その後にchar_p::Refを使うと解放済みメモリ参照(use-after-free)となり、未定義動作を引き起こす
-    // 4. タプルで両方を返すことで、呼び出し側がCStringの寿命を管理でき、ダングリングポインタを防止できる
-    // 5. 呼び出し側は `let _ = cstring;` などでCStringを保持し、参照が必要な間メモリが解放されないようにする
-    //
+/// Todoリスト全体の内容からハッシュ値を計算します
+///
+/// 各TodoのIDとノートを順番に反映するため、内容または並び順が変わるとハッシュ値も変わります。
+/// 計算方式は固定されているので、別プロセスで計算した値とも比較できます。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// Todoリストのハッシュ値
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, content_hash};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let before = content_hash(&app);
+///
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// assert_ne!(content_hash(&app), before);
+/// ```
+#[ffi_export]
+pub fn content_hash(app: &App) -> u64 {
+    let _call = record_call("content_hash");
+    let app = app.read();
+    hash_todos(&app.todos)
+}
+
+/// `content_hash` の本体
+fn hash_todos(todos: &[Todo]) -> u64 {
+    let mut hasher = StableHasher::new();
+    hasher.write(&(todos.len() as u64).to_le_bytes());
+    for todo in todos {
+        hasher.write_todo(todo);
+    }
+    hasher.finish()
+}
+
+/// 指定インデックスのTodoの内容からハッシュ値を計算します
+///
+/// `content_hash` と同じ計算方式で1件のTodoだけを対象にするため、
+/// 同期のたびに比較すれば、どのTodoが変更されたかを検出できます。
+/// 他のTodoの変更はハッシュ値に影響しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `index` - 対象とするTodoのインデックス（0から始まる）
+///
+/// # 戻り値
+///
+/// Todoのハッシュ値、インデックスが範囲外の場合は0を返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todo_hash_at};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// let before = todo_hash_at(&app, 0);
+///
+/// add_todo(&app, 2, char_p::Ref::from(note.as_ref()));
+/// assert_eq!(todo_hash_at(&app, 0), before);
+/// ```
+#[ffi_export]
+pub fn todo_hash_at(app: &App, index: usize) -> u64 {
+    let _call = record_call("todo_hash_at");
+    let app = app.read();
+    let Some(todo) = app.todos.get(index) else {
+        return 0;
+    };
+
+    let mut hasher = StableHasher::new();
+    hasher.write_todo(todo);
+    hasher.finish()
+}
+
+/// 現在のハッシュ値が一致する場合に限り、Todoリスト全体を置き換えます
+///
+/// 読み取り時点の `content_hash` を `expected` として渡すことで、
+/// その後に別の更新が入っていた場合は置き換えを行わない楽観的な更新ができます。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `expected` - 置き換え前のリストに期待するハッシュ値
+/// * `todos` - 新しいTodoリスト（文字列はコピーして保持されます）
+///
+/// # 戻り値
+///
+/// 置き換えた場合は`true`、ハッシュ値が一致せず何もしなかった場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, TodoRef, content_hash, get_todo_count, replace_all_if_hash};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("新しいタスク").unwrap();
+/// let todos = [TodoRef { id: 1, note: char_p::Ref::from(note.as_ref()) }];
+///
+/// let expected = content_hash(&app);
+/// assert!(replace_all_if_hash(&app, expected, c_slice::Ref::from(&todos[..])));
+/// assert_eq!(get_todo_count(&app), 1);
+///
+/// // 古いハッシュ値では置き換えられない
+/// assert!(!replace_all_if_hash(&app, expected, c_slice::Ref::from(&todos[..])));
+/// ```
+#[ffi_export]
+pub fn replace_all_if_hash(app: &App, expected: u64, todos: c_slice::Ref<'_, TodoRef<'_>>) -> bool {
+    let _call = record_call("replace_all_if_hash");
+    let mut app = app.write();
+    if hash_todos(&app.todos) != expected {
+        return false;
+    }
+
+    let native_vec: Vec<Todo> = todos.iter().map(Todo::from).collect();
+    app.todos = native_vec.into();
+
+    true
+}
+
+/// 指定IDのTodoのノートから前後の空白を取り除きます
+///
+/// 同じIDのTodoが複数ある場合は、先頭に近いものだけが対象になります。
+/// 空白を取り除いたノートは新しく確保した文字列に置き換えられます。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `id` - 対象とするTodoの識別子
+///
+/// # 戻り値
+///
+/// 対象のTodoが見つかった場合は`true`、見つからなかった場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, trim_todo_note};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("  牛乳を買う\t").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// assert!(trim_todo_note(&app, 1));
+/// assert_eq!(app.read().todos[0].note.to_str(), "牛乳を買う");
+/// assert!(!trim_todo_note(&app, 2));
+/// ```
+#[ffi_export]
+pub fn trim_todo_note(app: &App, id: i32) -> bool {
+    let _call = record_call("trim_todo_note");
+    let mut app = app.write();
+    let Some(todo) = app.todos.iter_mut().find(|todo| todo.id == id) else {
+        return false;
+    };
+
+    let trimmed = todo.note.to_str().trim().to_string();
+    todo.note = trimmed.try_into().unwrap();
+
+    true
+}
+
+/// `with_todo` のコールバックが書き戻すノートを受け取る構造体
+///
+/// C/Go言語からは不透明な型として扱われ、`todo_edit_set_note` でノートを設定します。
+#[derive_ReprC]
+#[repr(opaque)]
+#[derive(Debug, Default)]
+pub struct TodoEdit {
+    note: Option<char_p::Box>,
+}
+
+/// `with_todo` のコールバックが書き戻すノートを設定します
+///
+/// ノートはコピーして保持されるため、呼び出し後に `note` を解放しても構いません。
+/// 複数回呼び出した場合は最後に設定したノートが使われます。
+///
+/// # 引数
+///
+/// * `edit` - コールバックに渡された書き戻し先への参照
+/// * `note` - 書き戻すノート
+#[ffi_export]
+pub fn todo_edit_set_note(edit: &mut TodoEdit, note: char_p::Ref<'_>) {
+    let _call = record_call("todo_edit_set_note");
+    edit.note = Some(note.to_str().to_string().try_into().unwrap());
+}
+
+/// 指定IDのTodoを排他ロックを保持したままコールバックに渡し、設定されたノートで書き戻します
+///
+/// 検索からコールバックの呼び出し、書き戻しまでを1つのロックの中で行うため、
+/// 同じアプリケーションに対する他の操作が途中で割り込むことはありません。
+/// コールバックは `todo_edit_set_note` で新しいノートを設定し、書き戻す場合は`true`を返します。
+/// 新しいノートは `add_todo` と同様に検証関数の対象になります。
+/// 同じIDのTodoが複数ある場合は、先頭に近いものだけが対象になります。
+///
+/// コールバックはロックを保持したまま呼び出されるため、同じアプリケーションを
+/// 操作するFFI関数を中から呼び出してはいけません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `id` - 対象とするTodoの識別子
+/// * `updater` - 対象のTodoを受け取り、書き戻すかどうかを返す関数
+/// * `handle` - `updater` の第1引数にそのまま渡される値
+///
+/// # 戻り値
+///
+/// 書き戻した場合は`true`を返します。指定IDのTodoが存在しない場合、`updater` がNULLの場合、
+/// `updater` が`false`を返した場合、検証関数がノートを拒否した場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, Todo, TodoEdit, add_todo, todo_edit_set_note, with_todo};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// unsafe extern "C" fn append_mark(_handle: usize, todo: &Todo, edit: &mut TodoEdit) -> bool {
+///     let note = CString::new(format!("{}!", todo.note.to_str())).unwrap();
+///     todo_edit_set_note(edit, char_p::Ref::from(note.as_ref()));
+///     true
+/// }
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// assert!(with_todo(&app, 1, Some(append_mark), 0));
+/// assert_eq!(app.read().todos[0].note.to_str(), "タスク!");
+/// assert!(!with_todo(&app, 2, Some(append_mark), 0));
+/// ```
+#[ffi_export]
+pub fn with_todo(
+    app: &App,
+    id: i32,
+    updater: Option<unsafe extern "C" fn(usize, &Todo, &mut TodoEdit) -> bool>,
+    handle: usize,
+) -> bool {
+    let _call = record_call("with_todo");
+    let Some(updater) = updater else {
+        return false;
+    };
+
+    let mut app = app.write();
+    let Some(index) = app.todos.iter().position(|todo| todo.id == id) else {
+        return false;
+    };
+
+    let mut edit = TodoEdit::default();
+    // SAFETY: コールバックは呼び出し側が渡したもので、Todoはこの呼び出しの間ロックで保護されている
+    if !unsafe { updater(handle, &app.todos[index], &mut edit) } {
+        return false;
+    }
+
+    // ノートが設定されなかった場合は、変更せずに書き戻したものとして扱う
+    let Some(note) = edit.note else {
+        return true;
+    };
+    let note = note.as_ref();
+    if !note_accepted(&app, note) {
+        return false;
+    }
+
+    app.todos[index] = Todo::new(id, note.to_str());
+    true
+}
+
+/// 指定IDのTodoのインデックスを取得します
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `id` - 検索するTodoの識別子
+///
+/// # 戻り値
+///
+/// 最初に見つかったTodoのインデックス、見つからない場合は-1を返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, find_todo_index};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 7, char_p::Ref::from(note.as_ref()));
+///
+/// assert_eq!(find_todo_index(&app, 7), 0);
+/// assert_eq!(find_todo_index(&app, 8), -1);
+/// ```
+#[ffi_export]
+pub fn find_todo_index(app: &App, id: i32) -> i64 {
+    let _call = record_call("find_todo_index");
+    let app = app.read();
+    app.todos
+        .iter()
+        .position(|todo| todo.id == id)
+        .map_or(-1, |index| index as i64)
+}
+
+/// Todo追加時にノートを検証する関数を登録します
+///
+/// 登録後は `add_todo` のたびに `validator` が呼び出され、`false` が返された場合は
+/// Todoを追加しません。`validator` にNULLを渡すと検証関数の登録を解除します。
+///
+/// 検証の対象になるのは `add_todo`、`try_add_todo`、`add_todos`、`add_templated_todo`、
+/// `with_todo`、`upsert_todos` で保存されるノートだけです。
+/// `replace_all_if_hash`、`load_todos_from_json`、`load_todos_from_jsonl`、
+/// `load_todos_from_msgpack`、`import_todos_json_with_progress`、`apply_todos_patch_json` は
+/// Todoリストを丸ごと置き換える・差分を適用する操作のため、検証せずにそのまま保存します。
+///
+/// `validator` はアプリケーションの排他ロックを保持したまま呼び出されるため、
+/// 同じアプリケーションを操作するFFI関数を中から呼び出してはいけません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `validator` - ノートを検証する関数（NULLで解除）
+/// * `handle` - `validator` の第1引数にそのまま渡される値
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, set_note_validator};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// unsafe extern "C" fn reject_empty(_handle: usize, note: char_p::Raw) -> bool {
+///     !note.as_ref().to_str().is_empty()
+/// }
+///
+/// let app = App::default();
+/// set_note_validator(&app, Some(reject_empty), 0);
+///
+/// let empty = CString::new("").unwrap();
+/// assert!(!add_todo(&app, 1, char_p::Ref::from(empty.as_ref())));
+/// ```
+#[ffi_export]
+pub fn set_note_validator(
+    app: &App,
+    validator: Option<unsafe extern "C" fn(usize, char_p::Raw) -> bool>,
+    handle: usize,
+) {
+    let _call = record_call("set_note_validator");
+    let mut app = app.write();
+    app.note_validator = validator;
+    app.note_validator_handle = handle;
+}
+
+/// Todo追加時にIDの昇順を保つ位置へ挿入するかどうかを設定します
+///
+/// 有効にすると `add_todo` は末尾に追加する代わりに、二分探索で求めた位置へ挿入します。
+/// 同じIDのTodoがある場合は、その後ろに挿入されます。既存のTodoは並べ替えないため、
+/// リストが昇順に並んでいる間だけ順序が保たれます。デフォルトは無効です。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `enabled` - ソート挿入を有効にする場合は`true`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, get_todo_id_at, set_sorted_insert};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// set_sorted_insert(&app, true);
+///
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 3, char_p::Ref::from(note.as_ref()));
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// assert_eq!(get_todo_id_at(&app, 0), 1);
+/// ```
+#[ffi_export]
+pub fn set_sorted_insert(app: &App, enabled: bool) {
+    let _call = record_call("set_sorted_insert");
+    let mut app = app.write();
+    app.sorted_insert = enabled;
+}
+
+/// IDの昇順を保つために `id` を挿入すべき位置を取得します
+///
+/// `set_sorted_insert` を有効にした `add_todo` が挿入する位置と同じで、
+/// 同じIDのTodoがある場合はその後ろの位置を返します。
+/// Todoリストは変更しません。
+///
+/// # 前提条件
+///
+/// Todoリストが既にIDの昇順に並んでいる必要があります。
+/// 並んでいない場合、戻り値は0以上Todoの数以下であること以外は保証されません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `id` - 挿入するTodoのID
+///
+/// # 戻り値
+///
+/// `id` を挿入すべきインデックス（0以上Todoの数以下）
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, sorted_insert_pos};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// add_todo(&app, 5, char_p::Ref::from(note.as_ref()));
+///
+/// assert_eq!(sorted_insert_pos(&app, 3), 1);
+/// ```
+#[ffi_export]
+pub fn sorted_insert_pos(app: &App, id: i32) -> usize {
+    let _call = record_call("sorted_insert_pos");
+    let app = app.read();
+    sorted_insert_index(&app.todos, id)
+}
+
+/// 2つのアプリケーションのTodoリストを入れ替えます
+///
+/// Vecのポインタを交換するだけなので、ノートの再確保は発生しません。
+/// リビジョンや検証関数などTodoリスト以外の状態はそれぞれのアプリケーションに残ります。
+///
+/// # 引数
+///
+/// * `app` - 入れ替え対象のアプリケーションインスタンスへの参照
+/// * `other` - もう一方のアプリケーションインスタンスへの参照（`app` と同一の場合は何もしません）
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, swap_app_contents};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let other = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// swap_app_contents(&app, &other);
+/// assert_eq!(app.read().todos.len(), 0);
+/// assert_eq!(other.read().todos.len(), 1);
+/// ```
+#[ffi_export]
+pub fn swap_app_contents(app: &App, other: &App) {
+    let _call = record_call("swap_app_contents");
+    if std::ptr::eq(app, other) {
+        return;
+    }
+
+    // 逆向きの呼び出しと同時に実行されてもデッドロックしないよう、アドレス順にロックする
+    let (first, second) = if (app as *const App) < (other as *const App) {
+        (app, other)
+    } else {
+        (other, app)
+    };
+    let mut first = first.write();
+    let mut second = second.write();
+    std::mem::swap(&mut first.todos, &mut second.todos);
+}
+
+/// 指定IDのTodoだけをJSON文字列として取得します
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `id` - シリアライズするTodoの識別子
+///
+/// # 戻り値
+///
+/// `{"id":..,"note":..}` 形式のJSON文字列。指定IDのTodoが存在しない場合はNULLを返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todo_json_by_id};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("牛乳を買う").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let json = todo_json_by_id(&app, 1).unwrap();
+/// assert_eq!(json.to_str(), r#"{"id":1,"note":"牛乳を買う"}"#);
+/// assert!(todo_json_by_id(&app, 2).is_none());
+/// ```
+#[ffi_export]
+pub fn todo_json_by_id(app: &App, id: i32) -> Option<char_p::Box> {
+    let _call = record_call("todo_json_by_id");
+    let app = app.read();
+    let todo = app.todos.iter().find(|todo| todo.id == id)?;
+    let json = serde_json::to_string(todo).ok()?;
+    json.try_into().ok()
+}
+
+/// テンプレートの変数を展開したノートでTodoを追加します
+///
+/// `template` 中の `{{key}}` は `vars` の同じ `key` を持つ値に置き換えられます。
+/// 対応する変数がないプレースホルダーは `{{key}}` のまま残ります。
+/// 展開後のノートは `add_todo` と同様に検証関数の対象になります。
+///
+/// # 引数
+///
+/// * `app` - Todoを追加するアプリケーションインスタンスへの参照
+/// * `id` - 追加するTodoの一意識別子
+/// * `template` - `{{key}}` 形式のプレースホルダーを含むテンプレート
+/// * `vars` - プレースホルダーに埋め込む変数の一覧
+///
+/// # 戻り値
+///
+/// 追加が成功した場合は`true`、失敗した場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, TemplateVar, add_templated_todo};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let template = CString::new("{{who}}に電話する").unwrap();
+/// let key = CString::new("who").unwrap();
+/// let value = CString::new("友達").unwrap();
+/// let vars = [TemplateVar {
+///     key: char_p::Ref::from(key.as_ref()),
+///     value: char_p::Ref::from(value.as_ref()),
+/// }];
+///
+/// let template = char_p::Ref::from(template.as_ref());
+/// assert!(add_templated_todo(&app, 1, template, c_slice::Ref::from(&vars[..])));
+/// assert_eq!(app.read().todos[0].note.to_str(), "友達に電話する");
+/// ```
+#[ffi_export]
+pub fn add_templated_todo(
+    app: &App,
+    id: i32,
+    template: char_p::Ref<'_>,
+    vars: c_slice::Ref<'_, TemplateVar<'_>>,
+) -> bool {
+    let _call = record_call("add_templated_todo");
+    let mut app = app.write();
+    let rendered = render_template(template.to_str(), &vars);
+
+    // 入力はいずれもC文字列なので、展開結果にNUL文字が含まれることはない
+    let Ok(note) = std::ffi::CString::new(rendered) else {
+        return false;
+    };
+
+    insert_todo(&mut app, id, char_p::Ref::from(note.as_ref()))
+}
+
+/// ノートの文字列サイズに関する統計を取得します
+///
+/// 件数、合計、最小、最大、平均を1回の走査でまとめて計算します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// ノートのサイズ統計（ノートがない場合はすべて0）
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, note_alloc_stats};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for note in ["a", "abc"] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let stats = note_alloc_stats(&app);
+/// assert_eq!(stats.count, 2);
+/// assert_eq!(stats.total_bytes, 4);
+/// assert_eq!(stats.min_bytes, 1);
+/// assert_eq!(stats.max_bytes, 3);
+/// assert_eq!(stats.average_bytes, 2.0);
+/// ```
+#[ffi_export]
+pub fn note_alloc_stats(app: &App) -> NoteAllocStats {
+    let _call = record_call("note_alloc_stats");
+    let app = app.read();
+    let mut stats = NoteAllocStats::default();
+
+    for todo in app.todos.iter() {
+        let len = todo.note.to_str().len();
+        stats.min_bytes = if stats.count == 0 {
+            len
+        } else {
+            stats.min_bytes.min(len)
+        };
+        stats.max_bytes = stats.max_bytes.max(len);
+        stats.total_bytes += len;
+        stats.count += 1;
+    }
+
+    if stats.count > 0 {
+        stats.average_bytes = stats.total_bytes as f64 / stats.count as f64;
+    }
+
+    stats
+}
+
+/// 指定範囲のTodoをコピーして取得します
+///
+/// `offset` から最大 `limit` 件のTodoを、ノートも含めて新しく確保したVecにコピーします。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `offset` - コピーを開始するインデックス（0から始まる）
+/// * `limit` - コピーする最大件数
+///
+/// # 戻り値
+///
+/// コピーしたTodoのVec（範囲外の場合は空）
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, free_todo_vec, get_todos_range};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for id in 1..=3 {
+///     let note = CString::new("タスク").unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let todos = get_todos_range(&app, 1, 10);
+/// assert_eq!(todos.len(), 2);
+/// assert_eq!(todos[0].id, 2);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn get_todos_range(app: &App, offset: usize, limit: usize) -> repr_c::Vec<Todo> {
+    let _call = record_call("get_todos_range");
+    let app = app.read();
+    let native_vec: Vec<Todo> = app.todos.iter().skip(offset).take(limit).cloned().collect();
+    native_vec.into()
+}
+
+/// Todoを `batch_size` 件ずつ `sink` に渡します
+///
+/// 読み取りロックを最後まで保持したまま先頭から順にTodoを走査するため、
+/// 途中で他のスレッドがTodoリストを変更しても、`sink` には同じ時点の
+/// Todoリストが抜けや重複なく渡されます。Todoはコピーされず、`sink` に渡されたスライスは
+/// その呼び出しの間だけ有効です。`sink` が `false` を返した場合はそこで中断します。
+/// `sink` はアプリケーションのロックを保持したまま呼び出されるため、
+/// 同じアプリケーションを操作するFFI関数を中から呼び出してはいけません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `batch_size` - 1回の呼び出しで渡す最大件数
+/// * `sink` - Todoのスライスを受け取る関数。続ける場合は `true` を返す
+/// * `handle` - `sink` の第1引数にそのまま渡される値
+///
+/// # 戻り値
+///
+/// 最後まで渡し終えた場合は`true`、`sink` が中断した場合、`batch_size` が0の場合、
+/// `sink` がNULLの場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, Todo, add_todo, stream_todo_batches};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// unsafe extern "C" fn count(handle: usize, batch: c_slice::Ref<'_, Todo>) -> bool {
+///     let total = unsafe { &mut *(handle as *mut usize) };
+///     *total += batch.len();
+///     true
+/// }
+///
+/// let app = App::default();
+/// for id in 1..=5 {
+///     let note = CString::new("タスク").unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let mut total = 0usize;
+/// assert!(stream_todo_batches(&app, 2, Some(count), &mut total as *mut usize as usize));
+/// assert_eq!(total, 5);
+/// ```
+#[ffi_export]
+pub fn stream_todo_batches(
+    app: &App,
+    batch_size: usize,
+    sink: Option<unsafe extern "C" fn(usize, c_slice::Ref<'_, Todo>) -> bool>,
+    handle: usize,
+) -> bool {
+    let _call = record_call("stream_todo_batches");
+    let Some(sink) = sink else {
+        return false;
+    };
+    if batch_size == 0 {
+        return false;
+    }
+
+    let app = app.read();
+    // SAFETY: コールバックは呼び出し側が渡したもので、Todoはこの呼び出しの間ロックで保護されている
+    app.todos
+        .chunks(batch_size)
+        .all(|batch| unsafe { sink(handle, batch.into()) })
+}
+
+/// IDが指定した範囲に含まれるTodoをコピーして取得します
+///
+/// `low` 以上 `high` 以下のIDを持つTodoを、元の順序のまま返します。
+/// `low` が `high` より大きい場合は空のVecを返します。
+/// リストがIDの昇順に並んでいるとは限らないため、全体を走査します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `low` - IDの下限（この値を含む）
+/// * `high` - IDの上限（この値を含む）
+///
+/// # 戻り値
+///
+/// 条件に一致したTodoのコピー。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, free_todo_vec, get_todos_with_id_between};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// for id in [5, 1, 3] {
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let todos = get_todos_with_id_between(&app, 1, 3);
+/// assert_eq!(todos.len(), 2);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn get_todos_with_id_between(app: &App, low: i32, high: i32) -> repr_c::Vec<Todo> {
+    let _call = record_call("get_todos_with_id_between");
+    let app = app.read();
+    let native_vec: Vec<Todo> = app
+        .todos
+        .iter()
+        .filter(|todo| (low..=high).contains(&todo.id))
+        .cloned()
+        .collect();
+    native_vec.into()
+}
+
+/// IDによるTodoの検索結果
+///
+/// # フィールド
+///
+/// * `id` - 検索したID
+/// * `note` - 見つかったTodoのノート（見つからなかった場合はNULL）
+#[derive_ReprC]
+#[repr(C)]
+#[derive(Debug, Clone)]
+pub struct TodoLookup {
+    pub id: i32,
+    pub note: Option<char_p::Box>,
+}
+
+/// 複数のIDのTodoをまとめて取得します
+///
+/// 結果は `ids` と同じ順序・同じ件数で返され、見つからなかったIDは `note` がNULLになります。
+/// 同じIDのTodoが複数ある場合は、先頭に近いものを返します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `ids` - 取得するTodoのIDの配列
+///
+/// # 戻り値
+///
+/// `ids` の各要素に対応する検索結果。
+/// 返されたVecは `free_todo_lookups` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, free_todo_lookups, get_todos_by_ids};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let ids = [2, 1];
+/// let lookups = get_todos_by_ids(&app, c_slice::Ref::from(&ids[..]));
+/// assert!(lookups[0].note.is_none());
+/// assert_eq!(lookups[1].note.as_ref().unwrap().to_str(), "タスク");
+/// free_todo_lookups(lookups);
+/// ```
+#[ffi_export]
+pub fn get_todos_by_ids(app: &App, ids: c_slice::Ref<'_, i32>) -> repr_c::Vec<TodoLookup> {
+    let _call = record_call("get_todos_by_ids");
+    let app = app.read();
+    let mut first_by_id = HashMap::new();
+    for todo in app.todos.iter() {
+        first_by_id.entry(todo.id).or_insert(todo);
+    }
+
+    let native_vec: Vec<TodoLookup> = ids
+        .iter()
+        .map(|&id| TodoLookup {
+            id,
+            note: first_by_id.get(&id).map(|todo| todo.note.clone()),
+        })
+        .collect();
+    native_vec.into()
+}
+
+/// `get_todos_by_ids` で取得したVecを解放します
+///
+/// # 引数
+///
+/// * `_lookups` - 解放する検索結果（各ノートも合わせて解放されます）
+#[ffi_export]
+pub fn free_todo_lookups(_lookups: repr_c::Vec<TodoLookup>) {
+    let _call = record_call("free_todo_lookups");
+    // repr_c::Vec はドロップ時に要素ごとメモリを解放します
+}
+
+/// すべてのTodoをコピーして取得します
+///
+/// 1回の呼び出しでリスト全体をコピーするため、`get_todo_id_at` などを
+/// 件数分呼び出すよりもFFIの呼び出し回数を抑えられます。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// すべてのTodoのコピー
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, free_todo_vec, get_all_todos};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let todos = get_all_todos(&app);
+/// assert_eq!(todos.len(), 1);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn get_all_todos(app: &App) -> repr_c::Vec<Todo> {
+    let _call = record_call("get_all_todos");
+    let app = app.read();
+    app.todos.clone()
+}
+
+/// Todoリストのコピーとハッシュ値を同時に取得します
+///
+/// 1回の呼び出しの中で同じ状態からコピーとハッシュ値を求めるため、
+/// 返されたハッシュ値は必ず返されたリストの内容と対応します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// Todoリストのコピーとハッシュ値。`todos` は `free_todo_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, content_hash, free_todo_vec, snapshot_with_hash};
+///
+/// let app = App::default();
+/// let snapshot = snapshot_with_hash(&app);
+/// assert_eq!(snapshot.hash, content_hash(&app));
+/// free_todo_vec(snapshot.todos);
+/// ```
+#[ffi_export]
+pub fn snapshot_with_hash(app: &App) -> TodoSnapshot {
+    let _call = record_call("snapshot_with_hash");
+    let app = app.read();
+    TodoSnapshot {
+        todos: app.todos.clone(),
+        hash: hash_todos(&app.todos),
+    }
+}
+
+/// Rust側で確保したTodoのVecを解放します
+///
+/// # 引数
+///
+/// * `_todos` - 解放するTodoのVec（各Todoのノートも合わせて解放されます）
+#[ffi_export]
+pub fn free_todo_vec(_todos: repr_c::Vec<Todo>) {
+    let _call = record_call("free_todo_vec");
+    // repr_c::Vec はドロップ時に要素ごとメモリを解放します
+}
+
+/// IDの昇順になっていない最初の位置を取得します
+///
+/// `todos[i].id > todos[i + 1].id` となる最初の `i` を返します。
+/// 同じIDが隣り合っている場合は昇順とみなします。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// 最初に順序が崩れている位置のインデックス、IDの昇順に並んでいる場合は-1を返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, first_unsorted_by_id};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// for id in [1, 3, 2] {
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// assert_eq!(first_unsorted_by_id(&app), 1);
+/// ```
+#[ffi_export]
+pub fn first_unsorted_by_id(app: &App) -> i64 {
+    let _call = record_call("first_unsorted_by_id");
+    let app = app.read();
+    app.todos
+        .windows(2)
+        .position(|pair| pair[0].id > pair[1].id)
+        .map_or(-1, |index| index as i64)
+}
+
+/// ノートのバイト数が上限を超える最初のTodoの位置を取得します
+///
+/// バイト数はUTF-8でのバイト数で、終端のNUL文字は含みません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `max_bytes` - ノートのバイト数の上限
+///
+/// # 戻り値
+///
+/// ノートが `max_bytes` バイトを超える最初のTodoのインデックス、ない場合は-1を返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, first_oversized_note_index};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for note in ["短い", "とても長いノート"] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// assert_eq!(first_oversized_note_index(&app, 10), 1);
+/// assert_eq!(first_oversized_note_index(&app, 100), -1);
+/// ```
+#[ffi_export]
+pub fn first_oversized_note_index(app: &App, max_bytes: usize) -> i64 {
+    let _call = record_call("first_oversized_note_index");
+    let app = app.read();
+    app.todos
+        .iter()
+        .position(|todo| todo.note.to_str().len() > max_bytes)
+        .map_or(-1, |index| index as i64)
+}
+
+/// 指定インデックスのTodoのノートを、先頭から指定文字数までに切り詰めて取得します
+///
+/// 保存されているノートは変更せず、切り詰めたコピーを返します。
+/// 文字数はUnicodeのスカラー値単位で数えるため、マルチバイト文字の途中で切れることはありません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `index` - 取得するTodoのインデックス（0から始まる）
+/// * `max_chars` - 取得する最大文字数
+///
+/// # 戻り値
+///
+/// 切り詰めたノート、インデックスが範囲外の場合は空文字列を返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, get_todo_note_truncated_at};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("牛乳を買う").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// assert_eq!(get_todo_note_truncated_at(&app, 0, 2).to_str(), "牛乳");
+/// assert_eq!(get_todo_note_truncated_at(&app, 0, 10).to_str(), "牛乳を買う");
+/// ```
+#[ffi_export]
+pub fn get_todo_note_truncated_at(app: &App, index: usize, max_chars: usize) -> char_p::Box {
+    let _call = record_call("get_todo_note_truncated_at");
+    let app = app.read();
+    let Some(todo) = app.todos.get(index) else {
+        // エラーの場合は空文字列
+        return "".to_string().try_into().unwrap();
+    };
+
+    let note = todo.note.to_str();
+    let truncated = match note.char_indices().nth(max_chars) {
+        Some((end, _)) => &note[..end],
+        None => note,
+    };
+    truncated.to_string().try_into().unwrap()
+}
+
+/// ノートに指定した文字列を含むTodoの件数を取得します
+///
+/// 一致したTodoはコピーせず、件数だけを数えます。空文字列はすべてのノートに一致します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `substr` - ノートから検索する文字列
+///
+/// # 戻り値
+///
+/// ノートに `substr` を含むTodoの件数
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, count_todos_with_note_substring};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for note in ["牛乳を買う", "パンを買う", "掃除する"] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let substr = CString::new("買う").unwrap();
+/// assert_eq!(count_todos_with_note_substring(&app, char_p::Ref::from(substr.as_ref())), 2);
+/// ```
+#[ffi_export]
+pub fn count_todos_with_note_substring(app: &App, substr: char_p::Ref<'_>) -> usize {
+    let _call = record_call("count_todos_with_note_substring");
+    let app = app.read();
+    let substr = substr.to_str();
+    app.todos
+        .iter()
+        .filter(|todo| todo.note.to_str().contains(substr))
+        .count()
+}
+
+/// ノートが指定した文字列と完全に一致するTodoを取得します
+///
+/// 部分一致ではなく、ノート全体が `note` と等しいTodoだけが対象になります。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `note` - 比較する文字列
+///
+/// # 戻り値
+///
+/// ノートが `note` と等しいTodoのコピー（元の順序を保持）。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, find_todos_by_exact_note, free_todo_vec};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for note in ["牛乳", "牛乳を買う"] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let note = CString::new("牛乳").unwrap();
+/// let todos = find_todos_by_exact_note(&app, char_p::Ref::from(note.as_ref()));
+/// assert_eq!(todos.len(), 1);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn find_todos_by_exact_note(app: &App, note: char_p::Ref<'_>) -> repr_c::Vec<Todo> {
+    let _call = record_call("find_todos_by_exact_note");
+    let app = app.read();
+    let note = note.to_str();
+    let native_vec: Vec<Todo> = app
+        .todos
+        .iter()
+        .filter(|todo| todo.note.to_str() == note)
+        .cloned()
+        .collect();
+    native_vec.into()
+}
+
+/// ノートに複数の文字列のいずれかを含むTodoを取得します
+///
+/// 1つのTodoが複数の文字列を含む場合も、結果には1回だけ含まれます。
+/// `substrs` が空の場合は空のVecを返します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `substrs` - ノートから検索する文字列の配列
+///
+/// # 戻り値
+///
+/// 条件に一致したTodoのコピー（元の順序を保持）。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, filter_todos_by_any_note, free_todo_vec};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for (id, note) in [(1, "牛乳を買う"), (2, "掃除する"), (3, "散歩する")] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let milk = CString::new("牛乳").unwrap();
+/// let walk = CString::new("散歩").unwrap();
+/// let substrs = [char_p::Ref::from(milk.as_ref()), char_p::Ref::from(walk.as_ref())];
+/// let todos = filter_todos_by_any_note(&app, c_slice::Ref::from(&substrs[..]));
+/// assert_eq!(todos.len(), 2);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn filter_todos_by_any_note(
+    app: &App,
+    substrs: c_slice::Ref<'_, char_p::Ref<'_>>,
+) -> repr_c::Vec<Todo> {
+    let _call = record_call("filter_todos_by_any_note");
+    let app = app.read();
+    let substrs: Vec<&str> = substrs.iter().map(|substr| substr.to_str()).collect();
+    let native_vec: Vec<Todo> = app
+        .todos
+        .iter()
+        .filter(|todo| {
+            let note = todo.note.to_str();
+            substrs.iter().any(|substr| note.contains(substr))
+        })
+        .cloned()
+        .collect();
+    native_vec.into()
+}
+
+/// ノートに複数の文字列をすべて含むTodoを取得します
+///
+/// `substrs` が空の場合はすべてのTodoが一致します。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `substrs` - ノートから検索する文字列の配列
+///
+/// # 戻り値
+///
+/// 条件に一致したTodoのコピー（元の順序を保持）。
+/// 返されたVecは `free_todo_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, filter_todos_by_all_notes, free_todo_vec};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for (id, note) in [(1, "牛乳を買う"), (2, "牛乳を飲む")] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let milk = CString::new("牛乳").unwrap();
+/// let buy = CString::new("買う").unwrap();
+/// let substrs = [char_p::Ref::from(milk.as_ref()), char_p::Ref::from(buy.as_ref())];
+/// let todos = filter_todos_by_all_notes(&app, c_slice::Ref::from(&substrs[..]));
+/// assert_eq!(todos.len(), 1);
+/// free_todo_vec(todos);
+/// ```
+#[ffi_export]
+pub fn filter_todos_by_all_notes(
+    app: &App,
+    substrs: c_slice::Ref<'_, char_p::Ref<'_>>,
+) -> repr_c::Vec<Todo> {
+    let _call = record_call("filter_todos_by_all_notes");
+    let app = app.read();
+    let substrs: Vec<&str> = substrs.iter().map(|substr| substr.to_str()).collect();
+    let native_vec: Vec<Todo> = app
+        .todos
+        .iter()
+        .filter(|todo| {
+            let note = todo.note.to_str();
+            substrs.iter().all(|substr| note.contains(substr))
+        })
+        .cloned()
+        .collect();
+    native_vec.into()
+}
+
+/// 複数のTodoをまとめてアプリケーションに追加します
+///
+/// `todos` の順に `add_todo` と同じ規則で追加します。検証関数が拒否したノートのTodoは追加せず、
+/// 残りのTodoの追加は続けます。ソート挿入が有効な場合は、それぞれIDの昇順を保つ位置へ挿入します。
+/// Todoリストの再構築は1回だけなので、`add_todo` を繰り返し呼び出すより効率的です。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `todos` - 追加するTodoの一覧（文字列はコピーして保持されます）
+///
+/// # 戻り値
+///
+/// 追加したTodoの件数
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, TodoRef, add_todos, get_todo_count};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// let note = char_p::Ref::from(note.as_ref());
+/// let todos = [TodoRef { id: 1, note }, TodoRef { id: 2, note }];
+///
+/// assert_eq!(add_todos(&app, c_slice::Ref::from(&todos[..])), 2);
+/// assert_eq!(get_todo_count(&app), 2);
+/// ```
+#[ffi_export]
+pub fn add_todos(app: &App, todos: c_slice::Ref<'_, TodoRef<'_>>) -> usize {
+    let _call = record_call("add_todos");
+    let mut app = app.write();
+    let mut native_vec: Vec<Todo> = app.todos.iter().cloned().collect();
+    let mut added = 0;
+    for todo in todos.iter() {
+        if !note_accepted(&app, todo.note) {
+            continue;
+        }
+
+        if app.sorted_insert {
+            let index = sorted_insert_index(&native_vec, todo.id);
+            native_vec.insert(index, Todo::from(todo));
+        } else {
+            native_vec.push(Todo::from(todo));
+        }
+        added += 1;
+    }
+
+    app.todos = native_vec.into();
+    added
+}
+
+/// IDをキーにTodoをまとめて追加または更新します
+///
+/// 既に同じIDのTodoがある場合はそのノートを更新し（同じIDが複数ある場合は先頭のもの）、
+/// ない場合は `add_todo` と同じ位置（ソート挿入が有効な場合はIDの昇順を保つ位置、
+/// 無効な場合は末尾）に追加します。`todos` 内に同じIDが複数ある場合は、後のものが前のものを更新します。
+/// 更新・追加のどちらの場合も、検証関数が拒否したノートのTodoは反映せず、件数にも含めません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `todos` - 追加または更新するTodoの一覧（文字列はコピーして保持されます）
+///
+/// # 戻り値
+///
+/// 追加した件数と更新した件数
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, TodoRef, add_todo, upsert_todos};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let old = CString::new("古いノート").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(old.as_ref()));
+///
+/// let new = CString::new("新しいノート").unwrap();
+/// let note = char_p::Ref::from(new.as_ref());
+/// let todos = [TodoRef { id: 1, note }, TodoRef { id: 2, note }];
+///
+/// let counts = upsert_todos(&app, c_slice::Ref::from(&todos[..]));
+/// assert_eq!((counts.inserted, counts.updated), (1, 1));
+/// assert_eq!(app.read().todos[0].note.to_str(), "新しいノート");
+/// ```
+#[ffi_export]
+pub fn upsert_todos(app: &App, todos: c_slice::Ref<'_, TodoRef<'_>>) -> UpsertCounts {
+    let _call = record_call("upsert_todos");
+    let mut app = app.write();
+    let mut counts = UpsertCounts::default();
+    let mut native_vec: Vec<Todo> = app.todos.iter().cloned().collect();
+
+    for todo in todos.iter() {
+        if !note_accepted(&app, todo.note) {
+            continue;
+        }
+
+        match native_vec
+            .iter_mut()
+            .find(|existing| existing.id == todo.id)
+        {
+            Some(existing) => {
+                existing.note = todo.note.to_str().to_string().try_into().unwrap();
+                counts.updated += 1;
+            }
+            None => {
+                if app.sorted_insert {
+                    let index = sorted_insert_index(&native_vec, todo.id);
+                    native_vec.insert(index, Todo::from(todo));
+                } else {
+                    native_vec.push(Todo::from(todo));
+                }
+                counts.inserted += 1;
+            }
+        }
+    }
+
+    app.todos = native_vec.into();
+    counts
+}
+
+/// 同じIDのTodoを、それぞれ最後のものだけ残して削除します
+///
+/// 後から追加されたTodoほど新しいデータとみなし、各IDについて最も後ろにあるTodoを残します。
+/// 残ったTodoは元の並び順を保ち、削除したTodoのノートは解放されます。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// 削除したTodoの件数
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, dedup_todos_by_id_keep_last};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for note in ["古いノート", "新しいノート"] {
+///     let note = CString::new(note).unwrap();
+///     add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// assert_eq!(dedup_todos_by_id_keep_last(&app), 1);
+/// assert_eq!(app.read().todos[0].note.to_str(), "新しいノート");
+/// ```
+#[ffi_export]
+pub fn dedup_todos_by_id_keep_last(app: &App) -> usize {
+    let _call = record_call("dedup_todos_by_id_keep_last");
+    let mut app = app.write();
+    let mut removed = 0;
+
+    app.todos.with_rust_mut(|native_vec| {
+        let before = native_vec.len();
+
+        // 後ろから走査して、各IDで最初に見つかったもの（元の並びで最後のもの）だけを残す
+        let mut seen = HashSet::new();
+        let mut kept: Vec<Todo> = native_vec
+            .drain(..)
+            .rev()
+            .filter(|todo| seen.insert(todo.id))
+            .collect();
+        kept.reverse();
+
+        removed = before - kept.len();
+        *native_vec = kept;
+    });
+
+    removed
+}
+
+/// 指定インデックスのTodoのノートを、コピーせずにバイト列として参照します
+///
+/// # 注意
+///
+/// 返されるポインタはアプリケーション内部のノートを直接指しています。
+/// 対象のTodoのノートを変更する操作、Todoを追加・削除・並べ替える操作、
+/// アプリケーションの解放のいずれかを行うと無効になります。
+/// 参照先のメモリを書き換えたり解放したりしてはいけません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `index` - 参照するTodoのインデックス（0から始まる）
+///
+/// # 戻り値
+///
+/// ノートのバイト列（NUL終端を含まない長さ）、インデックスが範囲外の場合は空のスライスを返します
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, get_todo_note_bytes_at};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// assert_eq!(get_todo_note_bytes_at(&app, 0).as_slice(), "タスク".as_bytes());
+/// assert!(get_todo_note_bytes_at(&app, 1).is_empty());
+/// ```
+#[ffi_export]
+pub fn get_todo_note_bytes_at(app: &App, index: usize) -> c_slice::Ref<'_, u8> {
+    let _call = record_call("get_todo_note_bytes_at");
+    let app = app.read();
+    let Some(todo) = app.todos.get(index) else {
+        return (&[][..]).into();
+    };
+
+    let bytes = todo.note.to_str().as_bytes();
+    // SAFETY: ノートの文字列はロックとは別に確保されており、ドキュメントに記載した操作を
+    // 行うまでは解放されない
+    unsafe { std::slice::from_raw_parts(bytes.as_ptr(), bytes.len()) }.into()
+}
+
+/// すべてのTodoを1行に1件ずつのJSON（JSON Lines形式）として取得します
+///
+/// 各行は `{"id":..,"note":..}` 形式のオブジェクトで、すべての行が改行で終わります。
+/// 配列形式と異なり、行単位で追記や逐次的な読み込みができます。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// JSON Lines形式の文字列（Todoがない場合は空文字列）。
+/// シリアライズに失敗した場合はNULLを返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todos_to_jsonl};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// for id in 1..=2 {
+///     let note = CString::new(format!("タスク{id}")).unwrap();
+///     add_todo(&app, id, char_p::Ref::from(note.as_ref()));
+/// }
+///
+/// let jsonl = todos_to_jsonl(&app).unwrap();
+/// assert_eq!(
+///     jsonl.to_str(),
+///     "{\"id\":1,\"note\":\"タスク1\"}\n{\"id\":2,\"note\":\"タスク2\"}\n"
+/// );
+/// ```
+#[ffi_export]
+pub fn todos_to_jsonl(app: &App) -> Option<char_p::Box> {
+    let _call = record_call("todos_to_jsonl");
+    let app = app.read();
+    let mut jsonl = String::new();
+    for todo in app.todos.iter() {
+        jsonl.push_str(&serde_json::to_string(todo).ok()?);
+        jsonl.push('\n');
+    }
+    jsonl.try_into().ok()
+}
+
+/// JSON Lines形式の文字列からTodoリストを読み込みます
+///
+/// 1行に1件ずつ `{"id":..,"note":..}` 形式のオブジェクトを読み込み、現在のTodoリストを置き換えます。
+/// 空行（末尾の改行を含む）は無視します。いずれかの行の解析に失敗した場合、Todoリストは変更しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `jsonl` - JSON Lines形式の文字列
+///
+/// # 戻り値
+///
+/// 読み込みに成功した場合は`true`、失敗した場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, load_todos_from_jsonl};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let jsonl = CString::new("{\"id\":1,\"note\":\"タスク\"}\n").unwrap();
+///
+/// assert!(load_todos_from_jsonl(&app, char_p::Ref::from(jsonl.as_ref())));
+/// assert_eq!(app.read().todos[0].note.to_str(), "タスク");
+/// ```
+#[ffi_export]
+pub fn load_todos_from_jsonl(app: &App, jsonl: char_p::Ref<'_>) -> bool {
+    let _call = record_call("load_todos_from_jsonl");
+    let mut app = app.write();
+    let mut native_vec = Vec::new();
+    for line in jsonl.to_str().lines() {
+        if line.trim().is_empty() {
+            continue;
+        }
+
+        let Ok(record) = serde_json::from_str::<TodoRecord>(line) else {
+            return false;
+        };
+        let Ok(todo) = Todo::try_from(record) else {
+            return false;
+        };
+        native_vec.push(todo);
+    }
+
+    app.todos = native_vec.into();
+    true
+}
+
+/// `todos_to_json` が書き出す形式のスキーマバージョン
+///
+/// 書き出す形式を変更した場合は値を増やします。
+const SCHEMA_VERSION: u32 = 1;
+
+/// 現在のスキーマバージョンを取得します
+///
+/// # 戻り値
+///
+/// `todos_to_json` が書き出し、`load_todos_from_json` が読み込める形式のバージョン
+#[ffi_export]
+pub fn current_schema_version() -> u32 {
+    let _call = record_call("current_schema_version");
+    SCHEMA_VERSION
+}
+
+/// スキーマバージョン付きのTodo一覧（書き出し用）
+#[derive(serde::Serialize)]
+struct TodoDocument<'a> {
+    schema_version: u32,
+    todos: &'a [Todo],
+}
+
+/// 読み込むJSONのスキーマバージョンだけを取り出すための中間表現
+#[derive(serde::Deserialize)]
+struct SchemaHeader {
+    schema_version: u32,
+}
+
+/// JSONから読み込んだスキーマバージョン付きTodo一覧の中間表現
+#[derive(serde::Deserialize)]
+struct TodoDocumentRecord {
+    todos: Vec<TodoRecord>,
+}
+
+/// `load_todos_from_json` などの読み込み結果
+#[derive_ReprC]
+#[repr(i32)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum LoadStatus {
+    /// 読み込みに成功した
+    Ok,
+    /// データの形式が不正
+    Malformed,
+    /// 対応していないスキーマバージョン
+    UnsupportedSchema,
+}
+
+/// すべてのTodoをスキーマバージョン付きのJSONにシリアライズします
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// `{"schema_version":..,"todos":[..]}` 形式のJSON文字列。
+/// シリアライズに失敗した場合はNULLを返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todos_to_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let json = todos_to_json(&app).unwrap();
+/// assert_eq!(
+///     json.to_str(),
+///     r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#
+/// );
+/// ```
+#[ffi_export]
+pub fn todos_to_json(app: &App) -> Option<char_p::Box> {
+    let _call = record_call("todos_to_json");
+    let app = app.read();
+    let document = TodoDocument {
+        schema_version: SCHEMA_VERSION,
+        todos: &app.todos,
+    };
+
+    let json = serde_json::to_string(&document).ok()?;
+    json.try_into().ok()
+}
+
+/// スキーマバージョン付きのJSONからTodoリストを読み込みます
+///
+/// `todos_to_json` が書き出す形式を読み込み、現在のTodoリストを置き換えます。
+/// `schema_version` が現在のバージョンと異なる場合は、中身を解析せずに失敗します。
+/// 失敗した場合、Todoリストは変更しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `json` - スキーマバージョン付きのJSON文字列
+///
+/// # 戻り値
+///
+/// 読み込みの結果を表す `LoadStatus`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, LoadStatus, load_todos_from_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let json = CString::new(r#"{"schema_version":99,"todos":[]}"#).unwrap();
+///
+/// assert_eq!(
+///     load_todos_from_json(&app, char_p::Ref::from(json.as_ref())),
+///     LoadStatus::UnsupportedSchema
+/// );
+/// ```
+#[ffi_export]
+pub fn load_todos_from_json(app: &App, json: char_p::Ref<'_>) -> LoadStatus {
+    let _call = record_call("load_todos_from_json");
+    let mut app = app.write();
+    let json = json.to_str();
+    let Ok(header) = serde_json::from_str::<SchemaHeader>(json) else {
+        return LoadStatus::Malformed;
+    };
+    if header.schema_version != SCHEMA_VERSION {
+        return LoadStatus::UnsupportedSchema;
+    }
+
+    let Ok(document) = serde_json::from_str::<TodoDocumentRecord>(json) else {
+        return LoadStatus::Malformed;
+    };
+    let Ok(native_vec) = document
+        .todos
+        .into_iter()
+        .map(Todo::try_from)
+        .collect::<Result<Vec<Todo>, _>>()
+    else {
+        return LoadStatus::Malformed;
+    };
+
+    app.todos = native_vec.into();
+    LoadStatus::Ok
+}
+
+/// 古い形式のJSONを現在のスキーマバージョンの形式に変換します
+///
+/// 次の形式を読み込み、`todos_to_json` と同じ `{"schema_version":..,"todos":[..]}` 形式で返します。
+///
+/// * スキーマバージョン導入前の形式（`[{"id":..,"note":..}, ..]` のJSON配列）
+/// * 現在のスキーマバージョンの形式（内容はそのまま）
+///
+/// # 引数
+///
+/// * `json` - 変換するJSON文字列
+///
+/// # 戻り値
+///
+/// 現在の形式に変換したJSON文字列。
+/// 形式が不正な場合や、現在より新しいスキーマバージョンの場合はNULLを返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::migrate_todos_json;
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let legacy = CString::new(r#"[{"id":1,"note":"タスク"}]"#).unwrap();
+/// let migrated = migrate_todos_json(char_p::Ref::from(legacy.as_ref())).unwrap();
+/// assert_eq!(
+///     migrated.to_str(),
+///     r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#
+/// );
+/// ```
+#[ffi_export]
+pub fn migrate_todos_json(json: char_p::Ref<'_>) -> Option<char_p::Box> {
+    let _call = record_call("migrate_todos_json");
+    let value: serde_json::Value = serde_json::from_str(json.to_str()).ok()?;
+    let records: Vec<TodoRecord> = if value.is_array() {
+        // スキーマバージョン導入前の形式
+        serde_json::from_value(value).ok()?
+    } else {
+        let header = SchemaHeader::deserialize(&value).ok()?;
+        if header.schema_version != SCHEMA_VERSION {
+            return None;
+        }
+        TodoDocumentRecord::deserialize(&value).ok()?.todos
+    };
+
+    let todos = records
+        .into_iter()
+        .map(Todo::try_from)
+        .collect::<Result<Vec<Todo>, _>>()
+        .ok()?;
+    let document = TodoDocument {
+        schema_version: SCHEMA_VERSION,
+        todos: &todos,
+    };
+
+    let json = serde_json::to_string(&document).ok()?;
+    json.try_into().ok()
+}
+
+/// 2つのTodoリストの差分を表すパッチ（書き出し用）
+#[derive(serde::Serialize)]
+struct TodoPatch<'a> {
+    removed: Vec<i32>,
+    changed: Vec<&'a Todo>,
+    added: Vec<&'a Todo>,
+}
+
+/// JSONから読み込んだパッチの中間表現
+///
+/// 省略された配列は空として扱います。
+#[derive(serde::Deserialize)]
+struct TodoPatchRecord {
+    #[serde(default)]
+    removed: Vec<i32>,
+    #[serde(default)]
+    changed: Vec<TodoRecord>,
+    #[serde(default)]
+    added: Vec<TodoRecord>,
+}
+
+/// パッチを適用した後のTodoリストを求めます
+///
+/// `todos` 自体は変更しません。パッチが現在の状態に適用できない場合は`None`を返します。
+fn apply_patch_to(todos: &[Todo], patch: TodoPatchRecord) -> Option<Vec<Todo>> {
+    let existing: HashSet<i32> = todos.iter().map(|todo| todo.id).collect();
+    let removed: HashSet<i32> = patch.removed.iter().copied().collect();
+
+    // removedとchangedは既存のIDを指し、addedは残るTodoと重複しない必要がある
+    if !removed.iter().all(|id| existing.contains(id)) {
+        return None;
+    }
+    if !patch
+        .changed
+        .iter()
+        .all(|todo| existing.contains(&todo.id) && !removed.contains(&todo.id))
+    {
+        return None;
+    }
+    let mut added_ids = HashSet::new();
+    if !patch.added.iter().all(|todo| {
+        (!existing.contains(&todo.id) || removed.contains(&todo.id)) && added_ids.insert(todo.id)
+    }) {
+        return None;
+    }
+
+    let mut native_vec: Vec<Todo> = todos
+        .iter()
+        .filter(|todo| !removed.contains(&todo.id))
+        .cloned()
+        .collect();
+    for record in patch.changed {
+        let id = record.id;
+        let todo = Todo::try_from(record).ok()?;
+        if let Some(existing) = native_vec.iter_mut().find(|existing| existing.id == id) {
+            *existing = todo;
+        }
+    }
+    for record in patch.added {
+        native_vec.push(Todo::try_from(record).ok()?);
+    }
+
+    Some(native_vec)
+}
+
+/// 2つのアプリケーションのTodoリストの差分をJSONのパッチとして取得します
+///
+/// IDをキーに `base` と `other` を比較し、`{"removed":[..],"changed":[..],"added":[..]}` 形式で返します。
+///
+/// * `removed` - `other` にないIDの配列（`base` の順）
+/// * `changed` - 両方にあり、ノートが異なるTodo（`other` のノート）
+/// * `added` - `base` にないTodo（`other` の順）
+///
+/// 同じIDのTodoが複数ある場合は、それぞれ先頭のものだけを比較します。
+/// `other` が `base` の並び順を保ち、新しいTodoを末尾に追加したものであれば、
+/// `base` にパッチを適用した結果は `other` と同じ内容・並び順になります。
+///
+/// # 引数
+///
+/// * `base` - 比較元のTodoアプリケーションインスタンスへの参照
+/// * `other` - 比較先のTodoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// パッチのJSON文字列。シリアライズに失敗した場合はNULLを返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, todos_diff_patch_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let base = App::default();
+/// let other = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&base, 1, char_p::Ref::from(note.as_ref()));
+/// add_todo(&other, 2, char_p::Ref::from(note.as_ref()));
+///
+/// let patch = todos_diff_patch_json(&base, &other).unwrap();
+/// assert_eq!(
+///     patch.to_str(),
+///     r#"{"removed":[1],"changed":[],"added":[{"id":2,"note":"タスク"}]}"#
+/// );
+/// ```
+#[ffi_export]
+pub fn todos_diff_patch_json(base: &App, other: &App) -> Option<char_p::Box> {
+    let _call = record_call("todos_diff_patch_json");
+    let first_by_id = |todos: &[Todo]| {
+        let mut seen = HashSet::new();
+        todos
+            .iter()
+            .filter(|todo| seen.insert(todo.id))
+            .cloned()
+            .collect::<Vec<Todo>>()
+    };
+    // 同じインスタンスが渡された場合に備えて、ロックは1つずつ取る
+    let base_todos = first_by_id(&base.read().todos);
+    let other_todos = first_by_id(&other.read().todos);
+
+    let find = |todos: &[Todo], id: i32| todos.iter().position(|todo| todo.id == id);
+    let mut patch = TodoPatch {
+        removed: Vec::new(),
+        changed: Vec::new(),
+        added: Vec::new(),
+    };
+    for todo in &base_todos {
+        if find(&other_todos, todo.id).is_none() {
+            patch.removed.push(todo.id);
+        }
+    }
+    for todo in &other_todos {
+        match find(&base_todos, todo.id) {
+            Some(index) if base_todos[index].note.to_str() != todo.note.to_str() => {
+                patch.changed.push(todo)
+            }
+            Some(_) => {}
+            None => patch.added.push(todo),
+        }
+    }
+
+    let json = serde_json::to_string(&patch).ok()?;
+    json.try_into().ok()
+}
+
+/// JSONのパッチをTodoリストに適用します
+///
+/// `todos_diff_patch_json` が返す形式のパッチを読み込み、`removed` のIDを持つTodoをすべて削除し、
+/// `changed` のIDを持つ先頭のTodoのノートを更新してから、`added` のTodoを末尾に追加します。
+/// パッチの形式が不正な場合や、現在の状態に適用できない場合（`removed` や `changed` が存在しないIDを指す、
+/// `added` が残るTodoとIDが重複するなど）は、Todoリストを変更しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `patch` - パッチのJSON文字列
+///
+/// # 戻り値
+///
+/// 適用に成功した場合は`true`、失敗した場合は`false`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, apply_todos_patch_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let patch = CString::new(r#"{"changed":[{"id":1,"note":"更新"}]}"#).unwrap();
+/// assert!(apply_todos_patch_json(&app, char_p::Ref::from(patch.as_ref())));
+/// assert_eq!(app.read().todos[0].note.to_str(), "更新");
+/// ```
+#[ffi_export]
+pub fn apply_todos_patch_json(app: &App, patch: char_p::Ref<'_>) -> bool {
+    let _call = record_call("apply_todos_patch_json");
+    let mut app = app.write();
+    let Ok(patch) = serde_json::from_str::<TodoPatchRecord>(patch.to_str()) else {
+        return false;
+    };
+    let Some(native_vec) = apply_patch_to(&app.todos, patch) else {
+        return false;
+    };
+
+    app.todos = native_vec.into();
+    true
+}
+
+/// JSONのパッチが現在のTodoリストに適用できるかを確認します
+///
+/// `apply_todos_patch_json` と同じ検査を、Todoリストを変更せずに行います。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `patch` - パッチのJSON文字列
+///
+/// # 戻り値
+///
+/// パッチの形式が正しく、現在の状態に適用できる場合は`true`を返します。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, validate_todos_patch_json};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let patch = CString::new(r#"{"removed":[2]}"#).unwrap();
+/// assert!(!validate_todos_patch_json(&app, char_p::Ref::from(patch.as_ref())));
+/// ```
+#[ffi_export]
+pub fn validate_todos_patch_json(app: &App, patch: char_p::Ref<'_>) -> bool {
+    let _call = record_call("validate_todos_patch_json");
+    let app = app.read();
+    serde_json::from_str::<TodoPatchRecord>(patch.to_str())
+        .ok()
+        .and_then(|patch| apply_patch_to(&app.todos, patch))
+        .is_some()
+}
+
+/// すべてのTodoをMessagePack形式にシリアライズします
+///
+/// `todos_to_json` と同じく `{"schema_version":..,"todos":[..]}` 形式のマップとして、
+/// フィールド名付きで書き出します。各Todoは `{"id":..,"note":..}` 形式のマップです。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+///
+/// # 戻り値
+///
+/// MessagePack形式のバイト列。Todoがない場合もスキーマバージョンを含むため、
+/// シリアライズに失敗した場合のみ空のVecを返します。
+/// 返されたVecは `free_byte_vec` で解放する必要があります。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, add_todo, free_byte_vec, todos_to_msgpack};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+///
+/// let bytes = todos_to_msgpack(&app);
+/// // 要素数2のマップ
+/// assert_eq!(bytes[0], 0x82);
+/// free_byte_vec(bytes);
+/// ```
+#[ffi_export]
+pub fn todos_to_msgpack(app: &App) -> repr_c::Vec<u8> {
+    let _call = record_call("todos_to_msgpack");
+    let app = app.read();
+    let document = TodoDocument {
+        schema_version: SCHEMA_VERSION,
+        todos: &app.todos,
+    };
+    rmp_serde::to_vec_named(&document)
+        .unwrap_or_default()
+        .into()
+}
+
+/// MessagePack形式のバイト列からTodoリストを読み込みます
+///
+/// `todos_to_msgpack` が書き出す形式（`schema_version` と `todos` を持つマップ）を読み込み、
+/// 現在のTodoリストを置き換えます。`load_todos_from_json` と同様に、スキーマバージョンが
+/// `current_schema_version` と異なる場合は読み込みません。
+/// 読み込みに失敗した場合、Todoリストは変更しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `data` - MessagePack形式のバイト列
+///
+/// # 戻り値
+///
+/// 読み込みの結果を表す `LoadStatus`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, LoadStatus, add_todo, load_todos_from_msgpack, todos_to_msgpack};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let note = CString::new("タスク").unwrap();
+/// add_todo(&app, 1, char_p::Ref::from(note.as_ref()));
+/// let bytes = todos_to_msgpack(&app);
+///
+/// let restored = App::default();
+/// assert_eq!(
+///     load_todos_from_msgpack(&restored, c_slice::Ref::from(&bytes[..])),
+///     LoadStatus::Ok
+/// );
+/// assert_eq!(restored.read().todos[0].note.to_str(), "タスク");
+/// ```
+#[ffi_export]
+pub fn load_todos_from_msgpack(app: &App, data: c_slice::Ref<'_, u8>) -> LoadStatus {
+    let _call = record_call("load_todos_from_msgpack");
+    let mut app = app.write();
+    let Ok(header) = rmp_serde::from_slice::<SchemaHeader>(&data) else {
+        return LoadStatus::Malformed;
+    };
+    if header.schema_version != SCHEMA_VERSION {
+        return LoadStatus::UnsupportedSchema;
+    }
+
+    let Ok(document) = rmp_serde::from_slice::<TodoDocumentRecord>(&data) else {
+        return LoadStatus::Malformed;
+    };
+    let Ok(native_vec) = document
+        .todos
+        .into_iter()
+        .map(Todo::try_from)
+        .collect::<Result<Vec<Todo>, _>>()
+    else {
+        return LoadStatus::Malformed;
+    };
+
+    app.todos = native_vec.into();
+    LoadStatus::Ok
+}
+
+/// `todos_to_msgpack` などで取得したバイト列を解放します
+///
+/// # 引数
+///
+/// * `_bytes` - 解放するバイト列
+#[ffi_export]
+pub fn free_byte_vec(_bytes: repr_c::Vec<u8>) {
+    let _call = record_call("free_byte_vec");
+    // repr_c::Vec はドロップ時に自動的にメモリを解放します
+}
+
+/// ファイルの内容からチェックサムを計算します
+///
+/// `content_hash` と同じFNV-1a方式でファイルのバイト列をハッシュします。
+/// 保存したファイルの破損を、読み込み前に検出するために使います。
+///
+/// # 引数
+///
+/// * `path` - チェックサムを計算するファイルのパス
+/// * `checksum` - 計算したチェックサムの書き込み先
+///
+/// # 戻り値
+///
+/// 計算に成功した場合は`true`、ファイルを読み込めなかった場合は`false`を返します。
+/// 失敗した場合、`checksum` は変更しません。
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::checksum_file;
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let path = std::env::temp_dir().join("checksum_file_example.jsonl");
+/// std::fs::write(&path, "{\"id\":1,\"note\":\"タスク\"}\n").unwrap();
+///
+/// let cpath = CString::new(path.to_str().unwrap()).unwrap();
+/// let mut checksum = 0;
+/// assert!(checksum_file(char_p::Ref::from(cpath.as_ref()), &mut checksum));
+/// # std::fs::remove_file(&path).unwrap();
+/// ```
+#[ffi_export]
+pub fn checksum_file(path: char_p::Ref<'_>, checksum: &mut u64) -> bool {
+    let _call = record_call("checksum_file");
+    let Ok(contents) = std::fs::read(path.to_str()) else {
+        return false;
+    };
+
+    let mut hasher = StableHasher::new();
+    hasher.write(&contents);
+    *checksum = hasher.finish();
+    true
+}
+
+/// JSON配列の要素数だけを数えるための中間表現
+///
+/// 要素の中身は読み飛ばすため、Todoを確保せずに件数を求められます。
+struct ElementCount(usize);
+
+impl<'de> Deserialize<'de> for ElementCount {
+    fn deserialize<D: Deserializer<'de>>(deserializer: D) -> Result<Self, D::Error> {
+        struct CountVisitor;
+
+        impl<'de> Visitor<'de> for CountVisitor {
+            type Value = ElementCount;
+
+            fn expecting(&self, formatter: &mut fmt::Formatter<'_>) -> fmt::Result {
+                formatter.write_str("an array")
+            }
+
+            fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<ElementCount, A::Error> {
+                let mut count = 0;
+                while seq.next_element::<IgnoredAny>()?.is_some() {
+                    count += 1;
+                }
+                Ok(ElementCount(count))
+            }
+        }
+
+        deserializer.deserialize_seq(CountVisitor)
+    }
+}
+
+/// スキーマバージョン付きのJSONに含まれるTodoの件数だけを取り出すための中間表現
+#[derive(serde::Deserialize)]
+struct TodoCountRecord {
+    todos: ElementCount,
+}
+
+/// 進捗を通知しながらTodoの配列を読み込むためのシード
+///
+/// 配列の要素を1件解析するたびにTodoへ変換し、全体の約1%ごとに `report` を呼び出します。
+/// 配列全体を中間表現として保持せずに済みます。
+struct TodosWithProgress<'a> {
+    total: usize,
+    report: &'a dyn Fn(usize, usize),
+}
+
+impl<'de> DeserializeSeed<'de> for TodosWithProgress<'_> {
+    type Value = Vec<Todo>;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<Vec<Todo>, D::Error> {
+        deserializer.deserialize_seq(self)
+    }
+}
+
+impl<'de> Visitor<'de> for TodosWithProgress<'_> {
+    type Value = Vec<Todo>;
+
+    fn expecting(&self, formatter: &mut fmt::Formatter<'_>) -> fmt::Result {
+        formatter.write_str("an array of todos")
+    }
+
+    fn visit_seq<A: SeqAccess<'de>>(self, mut seq: A) -> Result<Vec<Todo>, A::Error> {
+        let interval = (self.total / 100).max(1);
+        let mut todos = Vec::with_capacity(self.total);
+        while let Some(record) = seq.next_element::<TodoRecord>()? {
+            todos.push(Todo::try_from(record).map_err(de::Error::custom)?);
+
+            let done = todos.len();
+            if done % interval == 0 && done != self.total {
+                (self.report)(done, self.total);
+            }
+        }
+        Ok(todos)
+    }
+}
+
+/// スキーマバージョン付きのJSONのうち、`todos` を `TodosWithProgress` で読み込むためのシード
+///
+/// `todos` 以外のフィールドは読み飛ばします。
+struct DocumentWithProgress<'a>(TodosWithProgress<'a>);
+
+impl<'de> DeserializeSeed<'de> for DocumentWithProgress<'_> {
+    type Value = Vec<Todo>;
+
+    fn deserialize<D: Deserializer<'de>>(self, deserializer: D) -> Result<Vec<Todo>, D::Error> {
+        deserializer.deserialize_map(self)
+    }
+}
+
+impl<'de> Visitor<'de> for DocumentWithProgress<'_> {
+    type Value = Vec<Todo>;
+
+    fn expecting(&self, formatter: &mut fmt::Formatter<'_>) -> fmt::Result {
+        formatter.write_str("a todo document")
+    }
+
+    fn visit_map<A: MapAccess<'de>>(self, mut map: A) -> Result<Vec<Todo>, A::Error> {
+        let mut seed = Some(self.0);
+        let mut todos = None;
+        while let Some(key) = map.next_key::<String>()? {
+            if key != "todos" {
+                map.next_value::<IgnoredAny>()?;
+                continue;
+            }
+
+            let Some(seed) = seed.take() else {
+                return Err(de::Error::duplicate_field("todos"));
+            };
+            todos = Some(map.next_value_seed(seed)?);
+        }
+        todos.ok_or_else(|| de::Error::missing_field("todos"))
+    }
+}
+
+/// JSONからTodoリストを読み込み、進捗をコールバックで通知します
+///
+/// `todos_to_json` が書き出す `{"schema_version":..,"todos":[..]}` 形式のJSONを読み込みます。
+/// `load_todos_from_json` と同様に、スキーマバージョンが `current_schema_version` と
+/// 異なる場合は読み込みません。古い形式のJSONは `migrate_todos_json` で変換してから渡します。
+///
+/// 最初にTodoを確保せずに全体の件数を数え、続く解析ではTodoを1件読むたびに変換しながら
+/// 全体の約1%ごとに `on_progress` を呼び出します。進捗は解析と同時に進むため、
+/// 入力全体の解析が終わるのを待たずに通知されます。成功した場合は最後に必ず
+/// `done == total` で呼び出します（Todoが0件の場合も `0, 0` で1回呼び出します）。
+/// 途中の要素で解析または変換に失敗した場合は、それまでの進捗を通知した後で失敗を返します。
+/// 読み込みに失敗した場合、Todoリストは変更しません。
+///
+/// # 引数
+///
+/// * `app` - Todoアプリケーションインスタンスへの参照
+/// * `json` - JSON文字列
+/// * `on_progress` - 進捗を受け取る関数（NULLの場合は通知しない）。
+///   引数は `handle`、変換済みの件数、全体の件数の順
+/// * `handle` - `on_progress` の第1引数にそのまま渡される値
+///
+/// # 戻り値
+///
+/// 読み込みの結果を表す `LoadStatus`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{App, LoadStatus, import_todos_json_with_progress};
+/// use safer_ffi::prelude::*;
+/// use std::ffi::CString;
+///
+/// let app = App::default();
+/// let json = CString::new(r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"}]}"#).unwrap();
+///
+/// assert_eq!(
+///     import_todos_json_with_progress(&app, char_p::Ref::from(json.as_ref()), None, 0),
+///     LoadStatus::Ok
+/// );
+/// assert_eq!(app.read().todos.len(), 1);
+/// ```
+#[ffi_export]
+pub fn import_todos_json_with_progress(
+    app: &App,
+    json: char_p::Ref<'_>,
+    on_progress: Option<unsafe extern "C" fn(usize, usize, usize)>,
+    handle: usize,
+) -> LoadStatus {
+    let _call = record_call("import_todos_json_with_progress");
+    let json = json.to_str();
+    let Ok(header) = serde_json::from_str::<SchemaHeader>(json) else {
+        return LoadStatus::Malformed;
+    };
+    if header.schema_version != SCHEMA_VERSION {
+        return LoadStatus::UnsupportedSchema;
+    }
+
+    let Ok(TodoCountRecord {
+        todos: ElementCount(total),
+    }) = serde_json::from_str(json)
+    else {
+        return LoadStatus::Malformed;
+    };
+
+    let report = |done: usize, total: usize| {
+        if let Some(on_progress) = on_progress {
+            // SAFETY: 通知関数は呼び出し側が渡したもので、この呼び出しの間有効
+            unsafe { on_progress(handle, done, total) };
+        }
+    };
+
+    let seed = DocumentWithProgress(TodosWithProgress {
+        total,
+        report: &report,
+    });
+    let mut deserializer = serde_json::Deserializer::from_str(json);
+    let Ok(native_vec) = seed.deserialize(&mut deserializer) else {
+        return LoadStatus::Malformed;
+    };
+    if deserializer.end().is_err() {
+        return LoadStatus::Malformed;
+    }
+    report(total, total);
+
+    // 通知関数からこのアプリケーションを参照できるよう、ロックは置き換えの間だけ取る
+    app.write().todos = native_vec.into();
+    LoadStatus::Ok
+}
+
+#[ffi_export]
+pub fn free_char_p_box(_boxed: char_p::Box) {
+    let _call = record_call("free_char_p_box");
+    // repr_c::Box はドロップ時に自動的にメモリを解放します
+    // この関数内で何もする必要はありません
+    // boxed は関数終了時に自動的にドロップされます
+}
+
+/// アプリケーションのメモリを解放します
+///
+/// この関数を呼び出すことで、アプリケーションが使用していたメモリリソースが
+/// 適切に解放されます。Go言語からの利用時には、defer文を使用して確実に呼び出すことが推奨されます。
+///
+/// # 引数
+///
+/// * `_app` - 解放するアプリケーションインスタンス
+///
+/// # 注意
+///
+/// この関数内では特別な処理は行われず、Rustの所有権システムによって自動的にメモリが解放されます。
+/// repr_c::Box はドロップ時に自動的にメモリを解放します。
+///
+/// # 使用例
+///
+/// ## Go
+///
+/// ```go
+/// import "example.com/todo"
+///
+/// func main() {
+///     app := todo.AppNew()
+///     defer todo.AppFree(app) // 確実にメモリを解放
+///
+///     // アプリの操作...
+/// }
+/// ```
+#[ffi_export]
+pub fn app_free(_app: repr_c::Box<App>) {
+    let _call = record_call("app_free");
+    // repr_c::Box はドロップ時に自動的にメモリを解放します
+    // この関数内で何もする必要はありません
+    // app は関数終了時に自動的にドロップされます
+}
+
+/// FFI関数の呼び出し回数の計測を有効または無効にします
+///
+/// 計測はライブラリ全体で共通です。無効にしてもそれまでの回数は保持されます。
+/// 計測用の関数（この関数や `get_call_counts` など）自体は回数に含まれません。
+///
+/// # 引数
+///
+/// * `enabled` - 計測を有効にする場合は`true`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{get_call_counts, get_revision, reset_call_counts, set_instrumentation, App};
+///
+/// let app = App::default();
+/// set_instrumentation(true);
+/// reset_call_counts();
+/// get_revision(&app);
+/// set_instrumentation(false);
+///
+/// let counts = get_call_counts();
+/// let revision = counts.iter().find(|c| c.name.to_str() == "get_revision").unwrap();
+/// assert_eq!(revision.count, 1);
+/// ```
+#[ffi_export]
+pub fn set_instrumentation(enabled: bool) {
+    INSTRUMENTATION_ENABLED.store(enabled, Ordering::Relaxed);
+}
+
+/// FFI関数の呼び出し回数の計測が有効かどうかを取得します
+///
+/// # 戻り値
+///
+/// 計測が有効な場合は`true`
+#[ffi_export]
+pub fn is_instrumentation_enabled() -> bool {
+    INSTRUMENTATION_ENABLED.load(Ordering::Relaxed)
+}
+
+/// 記録したFFI関数の呼び出し回数をすべて0に戻します
+#[ffi_export]
+pub fn reset_call_counts() {
+    CALL_COUNTS
+        .lock()
+        .unwrap_or_else(|err| err.into_inner())
+        .clear();
+}
+
+/// 記録したFFI関数の呼び出し回数を取得します
+///
+/// # 戻り値
+///
+/// 一度以上呼び出されたFFI関数の名前と回数の一覧（名前順）。
+/// 返されたVecは `free_call_counts` で解放する必要があります。
+#[ffi_export]
+pub fn get_call_counts() -> repr_c::Vec<CallCount> {
+    let counts = CALL_COUNTS.lock().unwrap_or_else(|err| err.into_inner());
+    let native_vec: Vec<CallCount> = counts
+        .iter()
+        .map(|(name, count)| CallCount {
+            name: name.to_string().try_into().unwrap(),
+            count: *count,
+        })
+        .collect();
+    native_vec.into()
+}
+
+/// `get_call_counts` で取得したVecを解放します
+///
+/// # 引数
+///
+/// * `_counts` - 解放する呼び出し回数の一覧
+#[ffi_export]
+pub fn free_call_counts(_counts: repr_c::Vec<CallCount>) {
+    // repr_c::Vec はドロップ時に要素ごとメモリを解放します
+}
+
+/// FFI関数の実行時間の計測を有効または無効にします
+///
+/// 有効にすると、各FFI関数がRust側で費やした時間を関数ごとに累積します。
+/// 計測はライブラリ全体で共通です。無効にしてもそれまでの累積時間は保持されます。
+/// 計測用の関数自体は対象に含まれません。
+///
+/// # 引数
+///
+/// * `enabled` - 計測を有効にする場合は`true`
+///
+/// # 使用例
+///
+/// ```rust
+/// use safer_ffi_example::{get_timing_stats, get_todo_count, reset_timing_stats, set_timing, App};
+///
+/// let app = App::default();
+/// set_timing(true);
+/// reset_timing_stats();
+/// get_todo_count(&app);
+/// set_timing(false);
+///
+/// let stats = get_timing_stats();
+/// assert!(stats.iter().any(|t| t.name.to_str() == "get_todo_count"));
+/// ```
+#[ffi_export]
+pub fn set_timing(enabled: bool) {
+    TIMING_ENABLED.store(enabled, Ordering::Relaxed);
+}
+
+/// 記録したFFI関数の累積実行時間をすべて0に戻します
+#[ffi_export]
+pub fn reset_timing_stats() {
+    CALL_NANOS
+        .lock()
+        .unwrap_or_else(|err| err.into_inner())
+        .clear();
+}
+
+/// 記録したFFI関数の累積実行時間を取得します
+///
+/// # 戻り値
+///
+/// 計測中に一度以上呼び出されたFFI関数の名前と累積時間の一覧（名前順）。
+/// 返されたVecは `free_timing_stats` で解放する必要があります。
+#[ffi_export]
+pub fn get_timing_stats() -> repr_c::Vec<CallTiming> {
+    let nanos = CALL_NANOS.lock().unwrap_or_else(|err| err.into_inner());
+    let native_vec: Vec<CallTiming> = nanos
+        .iter()
+        .map(|(name, nanos)| CallTiming {
+            name: name.to_string().try_into().unwrap(),
+            nanos: *nanos,
+        })
+        .collect();
+    native_vec.into()
+}
+
+/// `get_timing_stats` で取得したVecを解放します
+///
+/// # 引数
+///
+/// * `_stats` - 解放する累積実行時間の一覧
+#[ffi_export]
+pub fn free_timing_stats(_stats: repr_c::Vec<CallTiming>) {
+    // repr_c::Vec はドロップ時に要素ごとメモリを解放します
+}
+
+/// FFIヘッダーファイルを生成します
+///
+/// このプロジェクトのRust関数とデータ構造をC/C++/Go等から利用するための
+/// ヘッダーファイルを生成します。ビルド時に`headers`機能が有効な場合のみ利用可能です。
+///
+/// # 戻り値
+///
+/// ヘッダーファイルの生成結果を表すResult
+///
+/// # 使用例
+///
+/// ```rust,no_run
+/// #[cfg(feature = "headers")]
+/// fn main() -> std::io::Result<()> {
+///     safer_ffi_example::generate_headers()
+/// }
+///
+/// #[cfg(not(feature = "headers"))]
+/// fn main() {
+///     println!("headers機能が有効ではありません");
+/// }
+/// ```
+#[cfg(feature = "headers")]
+pub fn generate_headers() -> ::std::io::Result<()> {
+    ::safer_ffi::headers::builder()
+        .to_file("./go_example/safer_ffi_example.h")?
+        .generate()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::ffi::CStr;
+
+    // テスト用にchar_p::Refを作成するヘルパー関数
+    // CStringとchar_p::Refの両方を返す理由:
+    // 1. char_p::RefはCStringが持つヒープメモリ上の文字列データへのポインタを保持している
+    // 2. CStringがスコープを抜けてdropされると、そのヒープメモリは解放される
+    // 3. その後にchar_p::Refを使うと解放済みメモリ参照(use-after-free)となり、未定義動作を引き起こす
+    // 4. タプルで両方を返すことで、呼び出し側がCStringの寿命を管理でき、ダングリングポインタを防止できる
+    // 5. 呼び出し側は `let _ = cstring;` などでCStringを保持し、参照が必要な間メモリが解放されないようにする
+    //
     // メモリ構造の図解:
     //
     // CString オブジェクト        ヒープ上の文字列データ
@@ -472,37 +3514,1198 @@ mod tests {
     }
 
     #[test]
-    fn test_todo_new() {
-        let todo = Todo::new(42, "テストタスク");
-        assert_eq!(todo.id, 42);
-        assert_eq!(todo.note.to_str(), "テストタスク");
+    fn test_todo_new() {
+        let todo = Todo::new(42, "テストタスク");
+        assert_eq!(todo.id, 42);
+        assert_eq!(todo.note.to_str(), "テストタスク");
+    }
+
+    #[test]
+    fn test_app_new() {
+        let app = App::default();
+        assert_eq!(app.read().todos.len(), 0);
+    }
+
+    #[test]
+    fn test_bump_revision() {
+        let app = App::default();
+        assert_eq!(get_revision(&app), 0);
+
+        assert_eq!(bump_revision(&app), 1);
+        assert_eq!(bump_revision(&app), 2);
+        assert_eq!(get_revision(&app), 2);
+
+        // Todoの追加ではリビジョンは変化しない
+        let (cstring, note_ref) = c_str("テスト");
+        add_todo(&app, 1, note_ref);
+        assert_eq!(get_revision(&app), 2);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_todos_page_json() {
+        let app = App::default();
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("タスク2");
+        let (cstring3, note_ref3) = c_str("タスク3");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+        add_todo(&app, 3, note_ref3);
+
+        let json = todos_page_json(&app, 1, 5).unwrap();
+        assert_eq!(
+            json.to_str(),
+            r#"{"total":3,"offset":1,"limit":5,"todos":[{"id":2,"note":"タスク2"},{"id":3,"note":"タスク3"}]}"#
+        );
+
+        // 範囲外のオフセットでは空の配列になる
+        let json = todos_page_json(&app, 10, 5).unwrap();
+        assert_eq!(
+            json.to_str(),
+            r#"{"total":3,"offset":10,"limit":5,"todos":[]}"#
+        );
+
+        let _ = (cstring1, cstring2, cstring3);
+    }
+
+    #[test]
+    fn test_content_hash() {
+        let app1 = App::default();
+        let app2 = App::default();
+        assert_eq!(content_hash(&app1), content_hash(&app2));
+
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("タスク2");
+        add_todo(&app1, 1, note_ref1);
+        add_todo(&app1, 2, note_ref2);
+        add_todo(&app2, 2, note_ref2);
+        add_todo(&app2, 1, note_ref1);
+
+        // 並び順が異なればハッシュ値も異なる
+        assert_ne!(content_hash(&app1), content_hash(&app2));
+
+        // 同じ内容なら同じハッシュ値になる
+        let app3 = App::default();
+        app3.write().todos = app1.read().todos.clone();
+        assert_eq!(content_hash(&app1), content_hash(&app3));
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_todo_hash_at() {
+        let app = App::default();
+        assert_eq!(todo_hash_at(&app, 0), 0);
+
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("タスク2");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref1);
+
+        // IDが異なれば同じノートでもハッシュ値は異なる
+        let hash = todo_hash_at(&app, 0);
+        assert_ne!(hash, todo_hash_at(&app, 1));
+
+        // 他のTodoを変更してもハッシュ値は変わらない
+        app.write().todos[1].note = Todo::new(2, "タスク2").note;
+        assert_eq!(todo_hash_at(&app, 0), hash);
+
+        // ノートを変更するとハッシュ値が変わる
+        let updated = TodoRef {
+            id: 1,
+            note: note_ref2,
+        };
+        upsert_todos(&app, c_slice::Ref::from(&[updated][..]));
+        assert_ne!(todo_hash_at(&app, 0), hash);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_replace_all_if_hash() {
+        let app = App::default();
+        let (cstring1, note_ref1) = c_str("古いタスク");
+        add_todo(&app, 1, note_ref1);
+
+        let (cstring2, note_ref2) = c_str("新しいタスク");
+        let todos = [
+            TodoRef {
+                id: 10,
+                note: note_ref2,
+            },
+            TodoRef {
+                id: 11,
+                note: note_ref2,
+            },
+        ];
+
+        // ハッシュ値が一致しない場合は置き換えない
+        let stale = content_hash(&app).wrapping_add(1);
+        assert!(!replace_all_if_hash(
+            &app,
+            stale,
+            c_slice::Ref::from(&todos[..])
+        ));
+        assert_eq!(app.read().todos.len(), 1);
+        assert_eq!(app.read().todos[0].note.to_str(), "古いタスク");
+
+        // ハッシュ値が一致する場合は置き換える
+        let expected = content_hash(&app);
+        assert!(replace_all_if_hash(
+            &app,
+            expected,
+            c_slice::Ref::from(&todos[..])
+        ));
+        assert_eq!(app.read().todos.len(), 2);
+        assert_eq!(app.read().todos[0].id, 10);
+        assert_eq!(app.read().todos[1].note.to_str(), "新しいタスク");
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_trim_todo_note() {
+        let app = App::default();
+        let (cstring1, note_ref1) = c_str(" \tタスク1\t ");
+        let (cstring2, note_ref2) = c_str(" タスク2 ");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+
+        assert!(trim_todo_note(&app, 1));
+        assert_eq!(app.read().todos[0].note.to_str(), "タスク1");
+        // 他のTodoは変更されない
+        assert_eq!(app.read().todos[1].note.to_str(), " タスク2 ");
+
+        // 存在しないIDの場合はfalse
+        assert!(!trim_todo_note(&app, 3));
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_find_todo_index() {
+        let app = App::default();
+        assert_eq!(find_todo_index(&app, 1), -1);
+
+        let (cstring, note_ref) = c_str("テスト");
+        add_todo(&app, 1, note_ref);
+        add_todo(&app, 2, note_ref);
+        add_todo(&app, 2, note_ref);
+
+        assert_eq!(find_todo_index(&app, 1), 0);
+        // 同じIDが複数ある場合は最初のインデックス
+        assert_eq!(find_todo_index(&app, 2), 1);
+        assert_eq!(find_todo_index(&app, 3), -1);
+
+        let _ = cstring;
+    }
+
+    // ハンドルで指定した文字数未満のノートを拒否する検証関数
+    unsafe extern "C" fn min_chars_validator(handle: usize, note: char_p::Raw) -> bool {
+        note.as_ref().to_str().chars().count() >= handle
+    }
+
+    #[test]
+    fn test_set_note_validator() {
+        let app = App::default();
+        set_note_validator(&app, Some(min_chars_validator), 3);
+
+        let (cstring1, short_note) = c_str("短い");
+        let (cstring2, long_note) = c_str("十分に長い");
+        assert!(!add_todo(&app, 1, short_note));
+        assert_eq!(
+            try_add_todo(&app, 1, short_note),
+            AddStatus::ValidationFailed
+        );
+        assert!(add_todo(&app, 2, long_note));
+        assert_eq!(app.read().todos.len(), 1);
+        assert_eq!(app.read().todos[0].id, 2);
+
+        // 登録を解除すると短いノートも追加できる
+        set_note_validator(&app, None, 0);
+        assert!(add_todo(&app, 3, short_note));
+        assert_eq!(app.read().todos.len(), 2);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_swap_app_contents() {
+        let app1 = App::default();
+        let app2 = App::default();
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("タスク2");
+        add_todo(&app1, 1, note_ref1);
+        add_todo(&app2, 2, note_ref2);
+        add_todo(&app2, 3, note_ref2);
+        bump_revision(&app1);
+
+        swap_app_contents(&app1, &app2);
+
+        assert_eq!(app1.read().todos.len(), 2);
+        assert_eq!(app1.read().todos[0].id, 2);
+        assert_eq!(app2.read().todos.len(), 1);
+        assert_eq!(app2.read().todos[0].note.to_str(), "タスク1");
+        // Todoリスト以外の状態は入れ替わらない
+        assert_eq!(get_revision(&app1), 1);
+        assert_eq!(get_revision(&app2), 0);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_todo_json_by_id() {
+        let app = App::default();
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("\"引用\"付き");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+
+        let json = todo_json_by_id(&app, 2).unwrap();
+        assert_eq!(json.to_str(), r#"{"id":2,"note":"\"引用\"付き"}"#);
+
+        assert!(todo_json_by_id(&app, 3).is_none());
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_render_template() {
+        let (key1, key_ref1) = c_str("item");
+        let (value1, value_ref1) = c_str("牛乳");
+        let (key2, key_ref2) = c_str("shop");
+        let (value2, value_ref2) = c_str("{{item}}屋");
+        let vars = [
+            TemplateVar {
+                key: key_ref1,
+                value: value_ref1,
+            },
+            TemplateVar {
+                key: key_ref2,
+                value: value_ref2,
+            },
+        ];
+
+        assert_eq!(render_template("{{item}}を買う", &vars), "牛乳を買う");
+        // 対応する変数がないプレースホルダーはそのまま残る
+        assert_eq!(
+            render_template("{{item}}と{{unknown}}", &vars),
+            "牛乳と{{unknown}}"
+        );
+        // 置換後の値は再展開しない
+        assert_eq!(render_template("{{shop}}へ行く", &vars), "{{item}}屋へ行く");
+        // 閉じられていないプレースホルダーはそのまま残る
+        assert_eq!(render_template("{{item}}と{{item", &vars), "牛乳と{{item");
+        assert_eq!(render_template("変数なし", &[]), "変数なし");
+
+        let _ = (key1, value1, key2, value2);
+    }
+
+    #[test]
+    fn test_add_templated_todo() {
+        let app = App::default();
+        let (template, template_ref) = c_str("{{who}}に{{what}}を渡す");
+        let (key, key_ref) = c_str("who");
+        let (value, value_ref) = c_str("友達");
+        let vars = [TemplateVar {
+            key: key_ref,
+            value: value_ref,
+        }];
+
+        assert!(add_templated_todo(
+            &app,
+            1,
+            template_ref,
+            c_slice::Ref::from(&vars[..])
+        ));
+        assert_eq!(app.read().todos[0].id, 1);
+        assert_eq!(app.read().todos[0].note.to_str(), "友達に{{what}}を渡す");
+
+        let _ = (template, key, value);
+    }
+
+    #[test]
+    fn test_note_alloc_stats() {
+        let app = App::default();
+        assert_eq!(note_alloc_stats(&app), NoteAllocStats::default());
+
+        let (cstring1, note_ref1) = c_str("ab");
+        let (cstring2, note_ref2) = c_str("abcdef");
+        let (cstring3, note_ref3) = c_str("あ"); // UTF-8で3バイト
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+        add_todo(&app, 3, note_ref3);
+
+        let stats = note_alloc_stats(&app);
+        assert_eq!(stats.count, 3);
+        assert_eq!(stats.total_bytes, 11);
+        assert_eq!(stats.min_bytes, 2);
+        assert_eq!(stats.max_bytes, 6);
+        assert!((stats.average_bytes - 11.0 / 3.0).abs() < f64::EPSILON);
+
+        let _ = (cstring1, cstring2, cstring3);
+    }
+
+    #[test]
+    fn test_get_todos_range() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        for id in 0..5 {
+            add_todo(&app, id, note_ref);
+        }
+
+        let todos = get_todos_range(&app, 1, 3);
+        let ids: Vec<i32> = todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![1, 2, 3]);
+
+        // 末尾を超える範囲は切り詰められる
+        assert_eq!(get_todos_range(&app, 4, 10).len(), 1);
+        assert_eq!(get_todos_range(&app, 10, 10).len(), 0);
+
+        let _ = cstring;
+    }
+
+    // テスト用のstream_todo_batchesのコールバック（ハンドルはバッチごとのIDを記録するVec）
+    unsafe extern "C" fn collect_batch(handle: usize, batch: c_slice::Ref<'_, Todo>) -> bool {
+        let batches = unsafe { &mut *(handle as *mut Vec<Vec<i32>>) };
+        batches.push(batch.iter().map(|todo| todo.id).collect());
+        batches.len() < 2
+    }
+
+    #[test]
+    fn test_stream_todo_batches() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        for id in 0..5 {
+            add_todo(&app, id, note_ref);
+        }
+
+        // 2回目のバッチでコールバックが中断する
+        let mut batches: Vec<Vec<i32>> = Vec::new();
+        let handle = &mut batches as *mut Vec<Vec<i32>> as usize;
+        assert!(!stream_todo_batches(&app, 2, Some(collect_batch), handle));
+        assert_eq!(batches, vec![vec![0, 1], vec![2, 3]]);
+
+        // 最後まで渡し終えた場合はtrue
+        let mut batches: Vec<Vec<i32>> = Vec::new();
+        let handle = &mut batches as *mut Vec<Vec<i32>> as usize;
+        assert!(stream_todo_batches(&app, 5, Some(collect_batch), handle));
+        assert_eq!(batches, vec![vec![0, 1, 2, 3, 4]]);
+
+        // バッチサイズ0とNULLのコールバックは何もしない
+        assert!(!stream_todo_batches(&app, 0, Some(collect_batch), handle));
+        assert!(!stream_todo_batches(&app, 2, None, 0));
+        assert_eq!(batches.len(), 1);
+
+        let _ = cstring;
     }
 
     #[test]
-    fn test_app_new() {
+    fn test_get_all_todos() {
+        let app = App::default();
+        assert_eq!(get_all_todos(&app).len(), 0);
+
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("タスク2");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+
+        let todos = get_all_todos(&app);
+        assert_eq!(todos.len(), 2);
+        assert_eq!(todos[1].id, 2);
+        assert_eq!(todos[1].note.to_str(), "タスク2");
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_first_unsorted_by_id() {
+        let app = App::default();
+        assert_eq!(first_unsorted_by_id(&app), -1);
+
+        let (cstring, note_ref) = c_str("タスク");
+        for id in [1, 2, 2, 5] {
+            add_todo(&app, id, note_ref);
+        }
+        assert_eq!(first_unsorted_by_id(&app), -1);
+
+        for id in [4, 3] {
+            add_todo(&app, id, note_ref);
+        }
+        assert_eq!(first_unsorted_by_id(&app), 3);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_get_todo_note_truncated_at() {
+        let app = App::default();
+        assert_eq!(get_todo_note_truncated_at(&app, 0, 3).to_str(), "");
+
+        let (cstring, note_ref) = c_str("abcあいう");
+        add_todo(&app, 1, note_ref);
+
+        assert_eq!(get_todo_note_truncated_at(&app, 0, 0).to_str(), "");
+        assert_eq!(get_todo_note_truncated_at(&app, 0, 4).to_str(), "abcあ");
+        assert_eq!(get_todo_note_truncated_at(&app, 0, 6).to_str(), "abcあいう");
+        assert_eq!(
+            get_todo_note_truncated_at(&app, 0, 100).to_str(),
+            "abcあいう"
+        );
+        // 保存されているノートは変更されない
+        assert_eq!(app.read().todos[0].note.to_str(), "abcあいう");
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_count_todos_with_note_substring() {
+        let app = App::default();
+        let (cstring1, note_ref1) = c_str("牛乳を買う");
+        let (cstring2, note_ref2) = c_str("パンを買う");
+        let (cstring3, note_ref3) = c_str("掃除する");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+        add_todo(&app, 3, note_ref3);
+
+        let (substr1, substr_ref1) = c_str("買う");
+        let (substr2, substr_ref2) = c_str("洗濯");
+        let (substr3, substr_ref3) = c_str("");
+        assert_eq!(count_todos_with_note_substring(&app, substr_ref1), 2);
+        assert_eq!(count_todos_with_note_substring(&app, substr_ref2), 0);
+        // 空文字列はすべてに一致する
+        assert_eq!(count_todos_with_note_substring(&app, substr_ref3), 3);
+
+        let _ = (cstring1, cstring2, cstring3, substr1, substr2, substr3);
+    }
+
+    #[test]
+    fn test_snapshot_with_hash() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        add_todo(&app, 1, note_ref);
+        add_todo(&app, 2, note_ref);
+
+        let snapshot = snapshot_with_hash(&app);
+        assert_eq!(snapshot.todos.len(), 2);
+        assert_eq!(snapshot.hash, content_hash(&app));
+
+        // スナップショットから復元したリストも同じハッシュ値になる
+        let restored = App::default();
+        restored.write().todos = snapshot.todos.clone();
+        assert_eq!(content_hash(&restored), snapshot.hash);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_add_todos() {
+        let app = App::default();
+        set_sorted_insert(&app, true);
+        set_note_validator(&app, Some(min_chars_validator), 3);
+
+        let (cstring1, long_note) = c_str("十分に長い");
+        let (cstring2, short_note) = c_str("短");
+        add_todo(&app, 2, long_note);
+        let todos = [
+            TodoRef {
+                id: 3,
+                note: long_note,
+            },
+            TodoRef {
+                id: 1,
+                note: long_note,
+            },
+            TodoRef {
+                id: 0,
+                note: short_note,
+            },
+        ];
+
+        // 検証関数が拒否したTodoだけを除き、IDの昇順を保って追加する
+        assert_eq!(add_todos(&app, c_slice::Ref::from(&todos[..])), 2);
+        let ids: Vec<i32> = app.read().todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![1, 2, 3]);
+
+        assert_eq!(add_todos(&app, c_slice::Ref::from(&[][..])), 0);
+        assert_eq!(get_todo_count(&app), 3);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_upsert_todos() {
+        let app = App::default();
+        let (cstring1, old_ref) = c_str("古いノート");
+        add_todo(&app, 1, old_ref);
+        add_todo(&app, 2, old_ref);
+
+        let (cstring2, new_ref) = c_str("新しいノート");
+        let (cstring3, later_ref) = c_str("後のノート");
+        let todos = [
+            TodoRef {
+                id: 2,
+                note: new_ref,
+            },
+            TodoRef {
+                id: 3,
+                note: new_ref,
+            },
+            // 同じバッチ内で追加したTodoを更新する
+            TodoRef {
+                id: 3,
+                note: later_ref,
+            },
+        ];
+
+        let counts = upsert_todos(&app, c_slice::Ref::from(&todos[..]));
+        assert_eq!(
+            counts,
+            UpsertCounts {
+                inserted: 1,
+                updated: 2
+            }
+        );
+
+        let state = app.read();
+        let notes: Vec<(i32, &str)> = state
+            .todos
+            .iter()
+            .map(|todo| (todo.id, todo.note.to_str()))
+            .collect();
+        assert_eq!(
+            notes,
+            vec![(1, "古いノート"), (2, "新しいノート"), (3, "後のノート")]
+        );
+
+        let _ = (cstring1, cstring2, cstring3);
+    }
+
+    #[test]
+    fn test_get_todo_note_bytes_at() {
+        let app = App::default();
+        assert!(get_todo_note_bytes_at(&app, 0).is_empty());
+
+        let (cstring, note_ref) = c_str("重要なタスク");
+        add_todo(&app, 1, note_ref);
+
+        let bytes = get_todo_note_bytes_at(&app, 0);
+        assert_eq!(bytes.as_slice(), "重要なタスク".as_bytes());
+        // コピーではなく内部のノートを指している
+        assert_eq!(bytes.as_ptr(), app.read().todos[0].note.to_str().as_ptr());
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_todos_to_jsonl() {
+        let app = App::default();
+        assert_eq!(todos_to_jsonl(&app).unwrap().to_str(), "");
+
+        let (cstring1, note_ref1) = c_str("タスク1");
+        let (cstring2, note_ref2) = c_str("改行\nを含む");
+        add_todo(&app, 1, note_ref1);
+        add_todo(&app, 2, note_ref2);
+
+        let jsonl = todos_to_jsonl(&app).unwrap();
+        // ノート中の改行はエスケープされ、1件が1行に収まる
+        assert_eq!(
+            jsonl.to_str(),
+            "{\"id\":1,\"note\":\"タスク1\"}\n{\"id\":2,\"note\":\"改行\\nを含む\"}\n"
+        );
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_load_todos_from_jsonl() {
+        let app = App::default();
+        let (cstring1, jsonl) =
+            c_str("{\"id\":1,\"note\":\"タスク1\"}\r\n\n{\"id\":2,\"note\":\"タスク2\"}\n");
+        assert!(load_todos_from_jsonl(&app, jsonl));
+        assert_eq!(app.read().todos.len(), 2);
+        assert_eq!(app.read().todos[1].id, 2);
+        assert_eq!(app.read().todos[1].note.to_str(), "タスク2");
+
+        // 不正な行を含む場合は失敗し、リストは変更されない
+        let (cstring2, invalid) = c_str("{\"id\":3,\"note\":\"タスク3\"}\n{\"id\":");
+        assert!(!load_todos_from_jsonl(&app, invalid));
+        assert_eq!(app.read().todos.len(), 2);
+
+        // NUL文字を含むノートは読み込めない
+        let (cstring3, nul) = c_str("{\"id\":4,\"note\":\"a\\u0000b\"}");
+        assert!(!load_todos_from_jsonl(&app, nul));
+        assert_eq!(app.read().todos.len(), 2);
+
+        let _ = (cstring1, cstring2, cstring3);
+    }
+
+    #[test]
+    fn test_record_call() {
+        // 他のテストが呼び出さない名前で記録を確認する
+        fn count_of(name: &str) -> u64 {
+            get_call_counts()
+                .iter()
+                .find(|count| count.name.to_str() == name)
+                .map_or(0, |count| count.count)
+        }
+
+        set_instrumentation(true);
+        drop(record_call("test_only_function"));
+        drop(record_call("test_only_function"));
+        set_instrumentation(false);
+        assert_eq!(count_of("test_only_function"), 2);
+
+        // 無効な間は記録されない
+        drop(record_call("test_only_function"));
+        assert_eq!(count_of("test_only_function"), 2);
+    }
+
+    #[test]
+    fn test_set_sorted_insert() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        set_sorted_insert(&app, true);
+
+        for id in [5, 1, 4, 1, 3] {
+            add_todo(&app, id, note_ref);
+        }
+        let ids: Vec<i32> = app.read().todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![1, 1, 3, 4, 5]);
+
+        // 無効に戻すと末尾に追加される
+        set_sorted_insert(&app, false);
+        add_todo(&app, 2, note_ref);
+        assert_eq!(get_todo_id_at(&app, 5), 2);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_filter_todos_by_any_note() {
+        let app = App::default();
+        let (cstring1, note1) = c_str("牛乳とパンを買う");
+        let (cstring2, note2) = c_str("牛乳を飲む");
+        let (cstring3, note3) = c_str("掃除する");
+        add_todo(&app, 1, note1);
+        add_todo(&app, 2, note2);
+        add_todo(&app, 3, note3);
+
+        let (cstring4, milk) = c_str("牛乳");
+        let (cstring5, bread) = c_str("パン");
+        let substrs = [milk, bread];
+        let todos = filter_todos_by_any_note(&app, c_slice::Ref::from(&substrs[..]));
+        let ids: Vec<i32> = todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![1, 2]);
+
+        // 検索文字列が空の場合は何も一致しない
+        let empty: [char_p::Ref<'_>; 0] = [];
+        assert_eq!(
+            filter_todos_by_any_note(&app, c_slice::Ref::from(&empty[..])).len(),
+            0
+        );
+
+        let _ = (cstring1, cstring2, cstring3, cstring4, cstring5);
+    }
+
+    #[test]
+    fn test_filter_todos_by_all_notes() {
+        let app = App::default();
+        let (cstring1, note1) = c_str("牛乳とパンを買う");
+        let (cstring2, note2) = c_str("牛乳を飲む");
+        add_todo(&app, 1, note1);
+        add_todo(&app, 2, note2);
+
+        let (cstring3, milk) = c_str("牛乳");
+        let (cstring4, bread) = c_str("パン");
+        let substrs = [milk, bread];
+        let todos = filter_todos_by_all_notes(&app, c_slice::Ref::from(&substrs[..]));
+        assert_eq!(todos.len(), 1);
+        assert_eq!(todos[0].id, 1);
+
+        // 検索文字列が空の場合はすべて一致する
+        let empty: [char_p::Ref<'_>; 0] = [];
+        assert_eq!(
+            filter_todos_by_all_notes(&app, c_slice::Ref::from(&empty[..])).len(),
+            2
+        );
+
+        let _ = (cstring1, cstring2, cstring3, cstring4);
+    }
+
+    #[test]
+    fn test_checksum_file() {
+        let path = std::env::temp_dir().join("safer_ffi_example_test_checksum_file.txt");
+        std::fs::write(&path, "タスク").unwrap();
+        let (cstring, path_ref) = c_str(path.to_str().unwrap());
+
+        let mut first = 0;
+        assert!(checksum_file(path_ref, &mut first));
+
+        // 同じ内容なら同じ値、1バイト違えば異なる値になる
+        let mut second = 0;
+        assert!(checksum_file(path_ref, &mut second));
+        assert_eq!(first, second);
+        std::fs::write(&path, "タスケ").unwrap();
+        assert!(checksum_file(path_ref, &mut second));
+        assert_ne!(first, second);
+
+        // 読み込めない場合は書き込み先を変更しない
+        std::fs::remove_file(&path).unwrap();
+        let mut missing = 42;
+        assert!(!checksum_file(path_ref, &mut missing));
+        assert_eq!(missing, 42);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_sorted_insert_pos() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        assert_eq!(sorted_insert_pos(&app, 1), 0);
+
+        for id in [2, 4, 4, 6] {
+            add_todo(&app, id, note_ref);
+        }
+        assert_eq!(sorted_insert_pos(&app, 1), 0);
+        assert_eq!(sorted_insert_pos(&app, 3), 1);
+        // 同じIDがある場合はその後ろ
+        assert_eq!(sorted_insert_pos(&app, 4), 3);
+        assert_eq!(sorted_insert_pos(&app, 7), 4);
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_msgpack_round_trip() {
+        let app = App::default();
+        let (cstring1, note1) = c_str("牛乳を買う");
+        let (cstring2, note2) = c_str("");
+        add_todo(&app, -1, note1);
+        add_todo(&app, 100_000, note2);
+
+        let bytes = todos_to_msgpack(&app);
+        let restored = App::default();
+        assert_eq!(
+            load_todos_from_msgpack(&restored, c_slice::Ref::from(&bytes[..])),
+            LoadStatus::Ok
+        );
+        assert_eq!(content_hash(&restored), content_hash(&app));
+
+        // 壊れたデータや新しいスキーマバージョンでは変更しない
+        assert_eq!(
+            load_todos_from_msgpack(&restored, c_slice::Ref::from(&bytes[..bytes.len() - 1])),
+            LoadStatus::Malformed
+        );
+        let newer = rmp_serde::to_vec_named(&TodoDocument {
+            schema_version: SCHEMA_VERSION + 1,
+            todos: &[],
+        })
+        .unwrap();
+        assert_eq!(
+            load_todos_from_msgpack(&restored, c_slice::Ref::from(&newer[..])),
+            LoadStatus::UnsupportedSchema
+        );
+        assert_eq!(restored.read().todos.len(), 2);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_find_todos_by_exact_note() {
+        let app = App::default();
+        let (cstring1, milk) = c_str("milk");
+        let (cstring2, buy_milk) = c_str("buy milk");
+        add_todo(&app, 1, milk);
+        add_todo(&app, 2, buy_milk);
+        add_todo(&app, 3, milk);
+
+        let todos = find_todos_by_exact_note(&app, milk);
+        let ids: Vec<i32> = todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![1, 3]);
+
+        let (cstring3, missing) = c_str("mil");
+        assert_eq!(find_todos_by_exact_note(&app, missing).len(), 0);
+
+        let _ = (cstring1, cstring2, cstring3);
+    }
+
+    #[test]
+    fn test_call_timing() {
+        // 他のテストが呼び出さない名前で記録を確認する
+        fn nanos_of(name: &str) -> Option<u64> {
+            get_timing_stats()
+                .iter()
+                .find(|timing| timing.name.to_str() == name)
+                .map(|timing| timing.nanos)
+        }
+
+        set_timing(true);
+        {
+            let _call = record_call("test_only_timed_function");
+            std::thread::sleep(std::time::Duration::from_millis(1));
+        }
+        set_timing(false);
+        let recorded = nanos_of("test_only_timed_function").unwrap();
+        assert!(recorded >= 1_000_000);
+
+        // 無効な間は記録されない
+        drop(record_call("test_only_timed_function"));
+        assert_eq!(nanos_of("test_only_timed_function"), Some(recorded));
+    }
+
+    #[test]
+    fn test_dedup_todos_by_id_keep_last() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        for id in [1, 2, 1, 3, 2, 1] {
+            add_todo(&app, id, note_ref);
+        }
+        let (cstring_last, last_ref) = c_str("最新");
+        add_todo(&app, 3, last_ref);
+
+        assert_eq!(dedup_todos_by_id_keep_last(&app), 4);
+        let ids: Vec<i32> = app.read().todos.iter().map(|todo| todo.id).collect();
+        assert_eq!(ids, vec![2, 1, 3]);
+        assert_eq!(app.read().todos[2].note.to_str(), "最新");
+
+        // 重複がなければ何も削除しない
+        assert_eq!(dedup_todos_by_id_keep_last(&app), 0);
+
+        let _ = (cstring, cstring_last);
+    }
+
+    #[test]
+    fn test_import_todos_json_with_progress() {
+        use std::cell::RefCell;
+
+        thread_local! {
+            static PROGRESS: RefCell<Vec<(usize, usize, usize)>> = const { RefCell::new(Vec::new()) };
+        }
+        unsafe extern "C" fn record_progress(handle: usize, done: usize, total: usize) {
+            PROGRESS.with(|progress| progress.borrow_mut().push((handle, done, total)));
+        }
+
+        let records: Vec<String> = (0..250)
+            .map(|id| format!(r#"{{"id":{id},"note":"タスク{id}"}}"#))
+            .collect();
+        let json = format!(
+            r#"{{"schema_version":{SCHEMA_VERSION},"todos":[{}]}}"#,
+            records.join(",")
+        );
+        let (cstring, json) = c_str(&json);
+
+        let app = App::default();
+        assert_eq!(
+            import_todos_json_with_progress(&app, json, Some(record_progress), 7),
+            LoadStatus::Ok
+        );
+        assert_eq!(app.read().todos.len(), 250);
+
+        let progress = PROGRESS.with(|progress| progress.take());
+        assert!(progress
+            .iter()
+            .all(|&(handle, _, total)| handle == 7 && total == 250));
+        assert!(progress.windows(2).all(|pair| pair[0].1 < pair[1].1));
+        assert_eq!(progress.last(), Some(&(7, 250, 250)));
+
+        // 進捗は解析と同時に通知されるため、末尾の要素が不正でもそれまでの進捗は届く
+        let json = format!(
+            r#"{{"schema_version":{SCHEMA_VERSION},"todos":[{},{{"id":"x"}}]}}"#,
+            records.join(",")
+        );
+        let (cstring_tail, json) = c_str(&json);
+        assert_eq!(
+            import_todos_json_with_progress(&app, json, Some(record_progress), 7),
+            LoadStatus::Malformed
+        );
+        let progress = PROGRESS.with(|progress| progress.take());
+        assert!(!progress.is_empty());
+        assert!(progress
+            .iter()
+            .all(|&(_, done, total)| done < 251 && total == 251));
+
+        // 変換に失敗した場合や、スキーマバージョンが異なる場合は変更しない
+        let (cstring_bad, bad) =
+            c_str(r#"{"schema_version":1,"todos":[{"id":1,"note":"タスク"},{"id":"x"}]}"#);
+        assert_eq!(
+            import_todos_json_with_progress(&app, bad, None, 0),
+            LoadStatus::Malformed
+        );
+        let (cstring_legacy, legacy) = c_str(r#"[{"id":1,"note":"タスク"}]"#);
+        assert_eq!(
+            import_todos_json_with_progress(&app, legacy, None, 0),
+            LoadStatus::Malformed
+        );
+        let newer = format!(r#"{{"schema_version":{},"todos":[]}}"#, SCHEMA_VERSION + 1);
+        let (cstring_newer, newer) = c_str(&newer);
+        assert_eq!(
+            import_todos_json_with_progress(&app, newer, None, 0),
+            LoadStatus::UnsupportedSchema
+        );
+        assert_eq!(app.read().todos.len(), 250);
+
+        let _ = (
+            cstring,
+            cstring_tail,
+            cstring_bad,
+            cstring_legacy,
+            cstring_newer,
+        );
+    }
+
+    #[test]
+    fn test_first_oversized_note_index() {
+        let app = App::default();
+        assert_eq!(first_oversized_note_index(&app, 0), -1);
+
+        let (cstring1, short) = c_str("abc");
+        let (cstring2, long) = c_str("abcdef");
+        add_todo(&app, 1, short);
+        add_todo(&app, 2, long);
+        add_todo(&app, 3, long);
+
+        assert_eq!(first_oversized_note_index(&app, 2), 0);
+        assert_eq!(first_oversized_note_index(&app, 3), 1);
+        // 上限と同じバイト数は超えていない
+        assert_eq!(first_oversized_note_index(&app, 6), -1);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_todos_diff_patch_json() {
+        let base = App::default();
+        let other = App::default();
+        let (cstring1, old_note) = c_str("古い");
+        let (cstring2, new_note) = c_str("新しい");
+        add_todo(&base, 1, old_note);
+        add_todo(&base, 2, old_note);
+        add_todo(&base, 3, old_note);
+        add_todo(&other, 1, old_note);
+        add_todo(&other, 3, new_note);
+        add_todo(&other, 4, new_note);
+
+        let patch = todos_diff_patch_json(&base, &other).unwrap();
+        assert!(apply_todos_patch_json(&base, patch.as_ref()));
+        assert_eq!(content_hash(&base), content_hash(&other));
+
+        // 同じ内容同士の差分は空
+        let patch = todos_diff_patch_json(&base, &other).unwrap();
+        assert_eq!(patch.to_str(), r#"{"removed":[],"changed":[],"added":[]}"#);
+
+        let _ = (cstring1, cstring2);
+    }
+
+    #[test]
+    fn test_apply_todos_patch_json_rejects_inapplicable() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        add_todo(&app, 1, note_ref);
+        add_todo(&app, 2, note_ref);
+        let before = content_hash(&app);
+
+        for patch in [
+            r#"{"removed":[9]}"#,
+            r#"{"changed":[{"id":9,"note":"x"}]}"#,
+            r#"{"removed":[1],"changed":[{"id":1,"note":"x"}]}"#,
+            r#"{"added":[{"id":2,"note":"x"}]}"#,
+            r#"{"added":[{"id":3,"note":"x"},{"id":3,"note":"y"}]}"#,
+            r#"{"removed":"#,
+        ] {
+            let (cstring_patch, patch_ref) = c_str(patch);
+            assert!(!apply_todos_patch_json(&app, patch_ref), "{patch}");
+            let _ = cstring_patch;
+        }
+        assert_eq!(content_hash(&app), before);
+
+        // 削除したIDは同じパッチで追加し直せる
+        let (cstring_patch, patch_ref) = c_str(r#"{"removed":[2],"added":[{"id":2,"note":"x"}]}"#);
+        assert!(apply_todos_patch_json(&app, patch_ref));
+        assert_eq!(app.read().todos[1].note.to_str(), "x");
+
+        let _ = (cstring, cstring_patch);
+    }
+
+    #[test]
+    fn test_validate_todos_patch_json() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        add_todo(&app, 1, note_ref);
+        let before = content_hash(&app);
+
+        let (cstring_valid, valid) = c_str(r#"{"changed":[{"id":1,"note":"更新"}]}"#);
+        let (cstring_missing, missing) = c_str(r#"{"changed":[{"id":2,"note":"更新"}]}"#);
+        let (cstring_malformed, malformed) = c_str("{");
+        assert!(validate_todos_patch_json(&app, valid));
+        assert!(!validate_todos_patch_json(&app, missing));
+        assert!(!validate_todos_patch_json(&app, malformed));
+        assert_eq!(content_hash(&app), before);
+
+        let _ = (cstring, cstring_valid, cstring_missing, cstring_malformed);
+    }
+
+    #[test]
+    fn test_load_todos_from_json() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        add_todo(&app, 1, note_ref);
+        add_todo(&app, 2, note_ref);
+
+        let json = todos_to_json(&app).unwrap();
+        let restored = App::default();
+        assert_eq!(
+            load_todos_from_json(&restored, json.as_ref()),
+            LoadStatus::Ok
+        );
+        assert_eq!(content_hash(&restored), content_hash(&app));
+
+        // 新しいバージョンは中身が読めても拒否し、変更しない
+        let (cstring_newer, newer) = c_str(r#"{"schema_version":2,"todos":[{"id":9,"note":"x"}]}"#);
+        assert_eq!(
+            load_todos_from_json(&restored, newer),
+            LoadStatus::UnsupportedSchema
+        );
+        let (cstring_missing, missing) = c_str(r#"{"todos":[]}"#);
+        assert_eq!(
+            load_todos_from_json(&restored, missing),
+            LoadStatus::Malformed
+        );
+        let (cstring_bad, bad) = c_str(r#"{"schema_version":1,"todos":[{"id":1}]}"#);
+        assert_eq!(load_todos_from_json(&restored, bad), LoadStatus::Malformed);
+        assert_eq!(content_hash(&restored), content_hash(&app));
+
+        let _ = (cstring, cstring_newer, cstring_missing, cstring_bad);
+    }
+
+    #[test]
+    fn test_migrate_todos_json() {
+        let (cstring_legacy, legacy) = c_str(r#"[{"id":1,"note":"タスク"},{"id":2,"note":""}]"#);
+        let migrated = migrate_todos_json(legacy).unwrap();
+
+        let app = App::default();
+        assert_eq!(
+            load_todos_from_json(&app, migrated.as_ref()),
+            LoadStatus::Ok
+        );
+        assert_eq!(app.read().todos.len(), 2);
+
+        // 現在の形式はそのまま、新しい形式や不正な形式は変換しない
+        let current = todos_to_json(&app).unwrap();
+        assert_eq!(
+            migrate_todos_json(current.as_ref()).unwrap().to_str(),
+            current.to_str()
+        );
+        let (cstring_newer, newer) = c_str(r#"{"schema_version":2,"todos":[]}"#);
+        assert!(migrate_todos_json(newer).is_none());
+        let (cstring_bad, bad) = c_str(r#"[{"id":1}]"#);
+        assert!(migrate_todos_json(bad).is_none());
+
+        let _ = (cstring_legacy, cstring_newer, cstring_bad);
+    }
+
+    #[test]
+    fn test_get_todos_with_id_between() {
+        let app = App::default();
+        let (cstring, note_ref) = c_str("タスク");
+        for id in [i32::MIN, 10, -3, 7, 10, i32::MAX] {
+            add_todo(&app, id, note_ref);
+        }
+
+        let ids = |low, high| -> Vec<i32> {
+            get_todos_with_id_between(&app, low, high)
+                .iter()
+                .map(|todo| todo.id)
+                .collect()
+        };
+        assert_eq!(ids(-3, 10), vec![10, -3, 7, 10]);
+        assert_eq!(ids(i32::MIN, i32::MIN), vec![i32::MIN]);
+        assert_eq!(ids(i32::MAX, i32::MAX), vec![i32::MAX]);
+        assert_eq!(ids(11, 100), Vec::<i32>::new());
+        assert_eq!(ids(10, -3), Vec::<i32>::new());
+
+        let _ = cstring;
+    }
+
+    // テスト用のwith_todoのコールバック（ハンドルは追加する文字数）
+    unsafe extern "C" fn append_stars(handle: usize, todo: &Todo, edit: &mut TodoEdit) -> bool {
+        let note = format!("{}{}", todo.note.to_str(), "*".repeat(handle));
+        let (cstring, note_ref) = c_str(&note);
+        todo_edit_set_note(edit, note_ref);
+        let _ = cstring;
+        true
+    }
+
+    #[test]
+    fn test_with_todo() {
         let app = App::default();
-        assert_eq!(app.todos.len(), 0);
+        let (cstring, note_ref) = c_str("タスク");
+        add_todo(&app, 1, note_ref);
+        add_todo(&app, 2, note_ref);
+
+        assert!(with_todo(&app, 2, Some(append_stars), 2));
+        assert_eq!(app.read().todos[1].note.to_str(), "タスク**");
+        assert_eq!(app.read().todos[0].note.to_str(), "タスク");
+
+        assert!(!with_todo(&app, 3, Some(append_stars), 1));
+        assert!(!with_todo(&app, 1, None, 0));
+
+        // 検証関数が拒否したノートは書き戻さない
+        set_note_validator(&app, Some(min_chars_validator), 10);
+        assert!(!with_todo(&app, 1, Some(append_stars), 1));
+        assert_eq!(app.read().todos[0].note.to_str(), "タスク");
+
+        let _ = cstring;
+    }
+
+    #[test]
+    fn test_get_todos_by_ids() {
+        let app = App::default();
+        let (cstring1, first) = c_str("最初");
+        let (cstring2, second) = c_str("2番目");
+        add_todo(&app, 1, first);
+        add_todo(&app, 2, second);
+        add_todo(&app, 1, second);
+
+        let ids = [2, 3, 1, 2];
+        let lookups = get_todos_by_ids(&app, c_slice::Ref::from(&ids[..]));
+        let notes: Vec<Option<&str>> = lookups
+            .iter()
+            .map(|lookup| lookup.note.as_ref().map(|note| note.to_str()))
+            .collect();
+        assert_eq!(
+            notes,
+            vec![Some("2番目"), None, Some("最初"), Some("2番目")]
+        );
+        assert_eq!(
+            lookups.iter().map(|lookup| lookup.id).collect::<Vec<i32>>(),
+            ids
+        );
+
+        let _ = (cstring1, cstring2);
     }
 
     #[test]
     fn test_add_todo() {
-        let mut app = App::default();
+        let app = App::default();
 
         // Todoを追加
         let (cstring1, note_ref1) = c_str("タスク1");
-        let result = add_todo(&mut app, 1, note_ref1);
+        let result = add_todo(&app, 1, note_ref1);
         assert!(result);
-        assert_eq!(app.todos.len(), 1);
+        assert_eq!(app.read().todos.len(), 1);
 
         // 2つ目のTodoを追加
         let (cstring2, note_ref2) = c_str("タスク2");
-        add_todo(&mut app, 2, note_ref2);
+        add_todo(&app, 2, note_ref2);
 
-        assert_eq!(app.todos.len(), 2);
-        assert_eq!(app.todos[0].id, 1);
-        assert_eq!(app.todos[0].note.to_str(), "タスク1");
-        assert_eq!(app.todos[1].id, 2);
-        assert_eq!(app.todos[1].note.to_str(), "タスク2");
+        assert_eq!(app.read().todos.len(), 2);
+        assert_eq!(app.read().todos[0].id, 1);
+        assert_eq!(app.read().todos[0].note.to_str(), "タスク1");
+        assert_eq!(app.read().todos[1].id, 2);
+        assert_eq!(app.read().todos[1].note.to_str(), "タスク2");
 
         // CStringを変数に保持して、関数を抜けるまで生存期間を保証
         let _ = (cstring1, cstring2);
@@ -510,12 +4713,12 @@ mod tests {
 
     #[test]
     fn test_get_todo_count() {
-        let mut app = App::default();
+        let app = App::default();
         assert_eq!(get_todo_count(&app), 0);
 
         // Todoを追加
         let (cstring, note_ref) = c_str("テスト");
-        add_todo(&mut app, 1, note_ref);
+        add_todo(&app, 1, note_ref);
 
         assert_eq!(get_todo_count(&app), 1);
 
@@ -525,14 +4728,14 @@ mod tests {
 
     #[test]
     fn test_get_todo_id_at() {
-        let mut app = App::default();
+        let app = App::default();
 
         // 範囲外のインデックスにアクセス
         assert_eq!(get_todo_id_at(&app, 0), -1);
 
         // Todoを追加
         let (cstring, note_ref) = c_str("テスト");
-        add_todo(&mut app, 42, note_ref);
+        add_todo(&app, 42, note_ref);
 
         assert_eq!(get_todo_id_at(&app, 0), 42);
         // 範囲外のインデックスにアクセス
@@ -544,7 +4747,7 @@ mod tests {
 
     #[test]
     fn test_get_todo_note_at() {
-        let mut app = App::default();
+        let app = App::default();
 
         // 範囲外のインデックスにアクセス
         let empty_note = get_todo_note_at(&app, 0);
@@ -552,7 +4755,7 @@ mod tests {
 
         // Todoを追加
         let (cstring, note_ref) = c_str("重要なタスク");
-        add_todo(&mut app, 1, note_ref);
+        add_todo(&app, 1, note_ref);
 
         let retrieved_note = get_todo_note_at(&app, 0);
         assert_eq!(retrieved_note.to_str(), "重要なタスク");